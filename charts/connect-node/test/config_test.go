@@ -0,0 +1,242 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestConfigTls(t *testing.T) {
+	t.Parallel()
+
+	defaultArgs := func() []string {
+		test := DefaultTest()
+		return DefaultResources(t, test).Deployment.Value.Spec.Template.Spec.Containers[0].Args
+	}
+	clientVolume := corev1.Volume{
+		Name: "tls-client",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: "my-client-tls",
+			},
+		},
+	}
+	clientMount := corev1.VolumeMount{
+		Name:      "tls-client",
+		MountPath: "/etc/connect-node/certs",
+	}
+	caVolume := corev1.Volume{
+		Name: "tls-ca",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "my-ca",
+				},
+			},
+		},
+	}
+	caMount := corev1.VolumeMount{
+		Name:      "tls-ca",
+		MountPath: "/etc/connect-node/ca-cert",
+	}
+
+	tests := map[string]struct {
+		values  string
+		args    []string
+		volumes []corev1.Volume
+		mounts  []corev1.VolumeMount
+	}{
+		"client cert": {
+			values: `
+  tls:
+    clientCert:
+      enabled: true
+      secretName: my-client-tls
+`,
+			args: []string{
+				"--tlscert", "/etc/connect-node/certs/tls.crt",
+				"--tlskey", "/etc/connect-node/certs/tls.key",
+			},
+			volumes: []corev1.Volume{clientVolume},
+			mounts:  []corev1.VolumeMount{clientMount},
+		},
+		"ca certs": {
+			values: `
+  tls:
+    caCerts:
+      enabled: true
+      configMapName: my-ca
+`,
+			args: []string{
+				"--tlsca", "/etc/connect-node/ca-cert/ca.crt",
+			},
+			volumes: []corev1.Volume{caVolume},
+			mounts:  []corev1.VolumeMount{caMount},
+		},
+		"client cert and ca certs": {
+			values: `
+  tls:
+    clientCert:
+      enabled: true
+      secretName: my-client-tls
+      dir: /etc/tls
+      cert: client.crt
+      key: client.key
+    caCerts:
+      enabled: true
+      configMapName: my-ca
+      key: bundle.pem
+`,
+			args: []string{
+				"--tlscert", "/etc/tls/client.crt",
+				"--tlskey", "/etc/tls/client.key",
+				"--tlsca", "/etc/connect-node/ca-cert/bundle.pem",
+			},
+			volumes: []corev1.Volume{caVolume, clientVolume},
+			mounts: []corev1.VolumeMount{
+				caMount,
+				{Name: "tls-client", MountPath: "/etc/tls"},
+			},
+		},
+		"insecure": {
+			values: `
+  tls:
+    insecureSkipVerify: true
+`,
+			args: []string{
+				"--insecure",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += tt.values
+			expected := DefaultResources(t, test)
+
+			pts := &expected.Deployment.Value.Spec.Template.Spec
+			pts.Volumes = tt.volumes
+			ctr := &pts.Containers[0]
+			ctr.Args = append(defaultArgs(), tt.args...)
+			ctr.VolumeMounts = tt.mounts
+
+			RenderAndCheck(t, test, expected)
+		})
+	}
+}
+
+func TestConfigTlsInvalid(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		values string
+		err    string
+	}{
+		"client cert without secret": {
+			values: `
+  tls:
+    clientCert:
+      enabled: true
+`,
+			err: "config.tls.clientCert.secretName is required when clientCert is enabled",
+		},
+		"client cert without cert": {
+			values: `
+  tls:
+    clientCert:
+      enabled: true
+      secretName: my-client-tls
+      cert: ""
+`,
+			err: "config.tls.clientCert.cert is required if key is defined",
+		},
+		"client cert without key": {
+			values: `
+  tls:
+    clientCert:
+      enabled: true
+      secretName: my-client-tls
+      key: ""
+`,
+			err: "config.tls.clientCert.key is required if cert is defined",
+		},
+		"ca certs without source": {
+			values: `
+  tls:
+    caCerts:
+      enabled: true
+`,
+			err: "config.tls.caCerts.configMapName or secretName is required when caCerts is enabled",
+		},
+		"ca certs with both sources": {
+			values: `
+  tls:
+    caCerts:
+      enabled: true
+      configMapName: my-ca
+      secretName: my-ca
+`,
+			err: "config.tls.caCerts.configMapName and secretName can not both be set",
+		},
+		"ca certs without key": {
+			values: `
+  tls:
+    caCerts:
+      enabled: true
+      configMapName: my-ca
+      key: ""
+`,
+			err: "config.tls.caCerts.key is required when caCerts is enabled",
+		},
+		"insecure with ca certs": {
+			values: `
+  tls:
+    caCerts:
+      enabled: true
+      configMapName: my-ca
+    insecureSkipVerify: true
+`,
+			err: "config.tls.insecureSkipVerify can not be set when caCerts is enabled",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += tt.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `  runtime: https://git.example.com:8443/connect-runtime.git
+networkPolicy:
+  enabled: true
+  dns:
+    enabled: false
+`
+	actual := HelmRender(t, test)
+	require.True(t, actual.NetworkPolicy.HasValue)
+	np := actual.NetworkPolicy.Value.Spec
+
+	// the container does not listen on any port, so nothing is allowed in
+	require.Empty(t, actual.Deployment.Value.Spec.Template.Spec.Containers[0].Ports)
+	require.Equal(t, []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}, np.PolicyTypes)
+	require.Empty(t, np.Ingress)
+
+	require.Equal(t, []networkingv1.NetworkPolicyEgressRule{
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(4222)),
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(8443)),
+			},
+		},
+	}, np.Egress)
+}
@@ -0,0 +1,402 @@
+package test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type DynamicDefaults struct {
+	VersionLabel     string
+	HelmChartLabel   string
+	ConnectNodeImage string
+}
+
+type DynamicDefaultsGetter struct {
+	mu  sync.Mutex
+	set bool
+	dd  DynamicDefaults
+}
+
+var ddg DynamicDefaultsGetter
+
+func (d *DynamicDefaultsGetter) Get(t *testing.T) DynamicDefaults {
+	t.Helper()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.set {
+		return d.dd
+	}
+
+	test := DefaultTest()
+	r := HelmRender(t, test)
+
+	require.True(t, r.Deployment.HasValue)
+
+	var ok bool
+	d.dd.VersionLabel, ok = r.Deployment.Value.Labels["app.kubernetes.io/version"]
+	require.True(t, ok)
+	d.dd.HelmChartLabel, ok = r.Deployment.Value.Labels["helm.sh/chart"]
+	require.True(t, ok)
+
+	containers := r.Deployment.Value.Spec.Template.Spec.Containers
+	require.Len(t, containers, 1)
+	d.dd.ConnectNodeImage = containers[0].Image
+
+	return d.dd
+}
+
+func DefaultResources(t *testing.T, test *Test) *Resources {
+	fullName := test.FullName
+	chartName := test.ChartName
+	releaseName := test.ReleaseName
+
+	dd := ddg.Get(t)
+	dr := GenerateResources(fullName)
+
+	cnLabels := func() map[string]string {
+		return map[string]string{
+			"app.kubernetes.io/component":  "connect-node",
+			"app.kubernetes.io/instance":   releaseName,
+			"app.kubernetes.io/managed-by": "Helm",
+			"app.kubernetes.io/name":       chartName,
+			"app.kubernetes.io/version":    dd.VersionLabel,
+			"helm.sh/chart":                dd.HelmChartLabel,
+		}
+	}
+	cnSelectorLabels := func() map[string]string {
+		return map[string]string{
+			"app.kubernetes.io/component": "connect-node",
+			"app.kubernetes.io/instance":  releaseName,
+			"app.kubernetes.io/name":      chartName,
+		}
+	}
+
+	testLabels := func() map[string]string {
+		labels := cnLabels()
+		labels["app.kubernetes.io/component"] = "connect-node-test"
+		return labels
+	}
+	testHookAnnotations := func() map[string]string {
+		return map[string]string{
+			"helm.sh/hook":               "test",
+			"helm.sh/hook-weight":        "-1",
+			"helm.sh/hook-delete-policy": "before-hook-creation,hook-succeeded",
+		}
+	}
+
+	replicas1 := int32(1)
+	replicas2 := int32(2)
+	trueBool := true
+	falseBool := false
+	runAsUser := int64(10001)
+	testRunAsUser := int64(1000)
+	cpuUtilization := int32(80)
+	maxUnavailable := intstr.FromInt32(1)
+
+	return &Resources{
+		Deployment: Resource[appsv1.Deployment]{
+			ID:       dr.Deployment.ID,
+			HasValue: true,
+			Value: appsv1.Deployment{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Deployment",
+					APIVersion: "apps/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: cnLabels(),
+				},
+				Spec: appsv1.DeploymentSpec{
+					Replicas: &replicas1,
+					Selector: &v1.LabelSelector{
+						MatchLabels: cnSelectorLabels(),
+					},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: v1.ObjectMeta{
+							Labels: cnLabels(),
+						},
+						Spec: corev1.PodSpec{
+							SecurityContext: &corev1.PodSecurityContext{
+								RunAsNonRoot: &trueBool,
+								SeccompProfile: &corev1.SeccompProfile{
+									Type: corev1.SeccompProfileTypeRuntimeDefault,
+								},
+							},
+							Containers: []corev1.Container{
+								{
+									Image: dd.ConnectNodeImage,
+									Name:  "connect-node",
+									SecurityContext: &corev1.SecurityContext{
+										RunAsUser:                &runAsUser,
+										AllowPrivilegeEscalation: &falseBool,
+										Capabilities: &corev1.Capabilities{
+											Drop: []corev1.Capability{"ALL"},
+										},
+									},
+									Resources: corev1.ResourceRequirements{
+										Requests: corev1.ResourceList{
+											corev1.ResourceCPU:    resource.MustParse("100m"),
+											corev1.ResourceMemory: resource.MustParse("128Mi"),
+										},
+										Limits: corev1.ResourceList{
+											corev1.ResourceMemory: resource.MustParse("512Mi"),
+										},
+									},
+									Args: []string{
+										"run",
+										"-s",
+										"nats://connect.ngs.global",
+										"--runtime",
+										"https://github.com/synadia-io/connect-runtime-wombat.git",
+										"--store",
+										"jetstream",
+										"--executor",
+										"nex",
+										"--nex-workload-type",
+										"connector",
+									},
+								},
+							},
+							EnableServiceLinks: &falseBool,
+							ServiceAccountName: fullName,
+						},
+					},
+				},
+			},
+		},
+		HPA: Resource[autoscalingv2.HorizontalPodAutoscaler]{
+			ID:       dr.HPA.ID,
+			HasValue: false,
+			Value: autoscalingv2.HorizontalPodAutoscaler{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "HorizontalPodAutoscaler",
+					APIVersion: "autoscaling/v2",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: cnLabels(),
+				},
+				Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+					ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+						APIVersion: "apps/v1",
+						Kind:       "Deployment",
+						Name:       fullName,
+					},
+					MinReplicas: &replicas2,
+					MaxReplicas: 10,
+					Metrics: []autoscalingv2.MetricSpec{
+						{
+							Type: autoscalingv2.ResourceMetricSourceType,
+							Resource: &autoscalingv2.ResourceMetricSource{
+								Name: corev1.ResourceCPU,
+								Target: autoscalingv2.MetricTarget{
+									Type:               autoscalingv2.UtilizationMetricType,
+									AverageUtilization: &cpuUtilization,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		ImagePullSecret: Resource[corev1.Secret]{
+			ID:       dr.ImagePullSecret.ID,
+			HasValue: false,
+			Value: corev1.Secret{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Secret",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-regcred",
+					Labels: cnLabels(),
+				},
+				Type: corev1.SecretTypeDockerConfigJson,
+				StringData: map[string]string{
+					corev1.DockerConfigJsonKey: `{"auths":{"registry.synadia.io":{}}}
+`,
+				},
+			},
+		},
+		NetworkPolicy: Resource[networkingv1.NetworkPolicy]{
+			ID:       dr.NetworkPolicy.ID,
+			HasValue: false,
+			Value: networkingv1.NetworkPolicy{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "NetworkPolicy",
+					APIVersion: "networking.k8s.io/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: cnLabels(),
+				},
+			},
+		},
+		PodDisruptionBudget: Resource[policyv1.PodDisruptionBudget]{
+			ID:       dr.PodDisruptionBudget.ID,
+			HasValue: true,
+			Value: policyv1.PodDisruptionBudget{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "PodDisruptionBudget",
+					APIVersion: "policy/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: cnLabels(),
+				},
+				Spec: policyv1.PodDisruptionBudgetSpec{
+					MaxUnavailable: &maxUnavailable,
+					Selector: &v1.LabelSelector{
+						MatchLabels: cnSelectorLabels(),
+					},
+				},
+			},
+		},
+		ServiceAccount: Resource[corev1.ServiceAccount]{
+			ID:       dr.ServiceAccount.ID,
+			HasValue: true,
+			Value: corev1.ServiceAccount{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "ServiceAccount",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: cnLabels(),
+				},
+			},
+		},
+		TestPod: Resource[corev1.Pod]{
+			ID:       dr.TestPod.ID,
+			HasValue: true,
+			Value: corev1.Pod{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Pod",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-test",
+					Labels: testLabels(),
+					Annotations: map[string]string{
+						"helm.sh/hook":               "test",
+						"helm.sh/hook-delete-policy": "before-hook-creation,hook-succeeded",
+					},
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot: &trueBool,
+						RunAsUser:    &testRunAsUser,
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "docker.io/alpine/k8s:1.31.4",
+							Command: []string{
+								"sh",
+								"-ec",
+								`kubectl rollout status "deployment/${DEPLOYMENT}" --timeout=120s
+`,
+							},
+							Env: []corev1.EnvVar{
+								{Name: "HOME", Value: "/tmp"},
+								{Name: "DEPLOYMENT", Value: fullName},
+							},
+						},
+					},
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: fullName + "-test",
+				},
+			},
+		},
+		TestServiceAccount: Resource[corev1.ServiceAccount]{
+			ID:       dr.TestServiceAccount.ID,
+			HasValue: true,
+			Value: corev1.ServiceAccount{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "ServiceAccount",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:        fullName + "-test",
+					Labels:      cnLabels(),
+					Annotations: testHookAnnotations(),
+				},
+			},
+		},
+		TestRole: Resource[rbacv1.Role]{
+			ID:       dr.TestRole.ID,
+			HasValue: true,
+			Value: rbacv1.Role{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Role",
+					APIVersion: "rbac.authorization.k8s.io/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:        fullName + "-test",
+					Labels:      cnLabels(),
+					Annotations: testHookAnnotations(),
+				},
+				Rules: []rbacv1.PolicyRule{
+					{
+						APIGroups: []string{"apps"},
+						Resources: []string{"deployments", "replicasets"},
+						Verbs:     []string{"get", "list", "watch"},
+					},
+				},
+			},
+		},
+		TestRoleBinding: Resource[rbacv1.RoleBinding]{
+			ID:       dr.TestRoleBinding.ID,
+			HasValue: true,
+			Value: rbacv1.RoleBinding{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "RoleBinding",
+					APIVersion: "rbac.authorization.k8s.io/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:        fullName + "-test",
+					Labels:      cnLabels(),
+					Annotations: testHookAnnotations(),
+				},
+				RoleRef: rbacv1.RoleRef{
+					APIGroup: "rbac.authorization.k8s.io",
+					Kind:     "Role",
+					Name:     fullName + "-test",
+				},
+				Subjects: []rbacv1.Subject{
+					{
+						Kind:      "ServiceAccount",
+						Name:      fullName + "-test",
+						Namespace: test.Namespace,
+					},
+				},
+			},
+		},
+	}
+}
+
+func networkPolicyPort(protocol corev1.Protocol, port intstr.IntOrString) networkingv1.NetworkPolicyPort {
+	return networkingv1.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &port,
+	}
+}
+
+func TestDefaultValues(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	expected := DefaultResources(t, test)
+	RenderAndCheck(t, test, expected)
+}
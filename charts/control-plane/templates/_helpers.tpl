@@ -36,16 +36,102 @@ Set default values.
 {{- define "scp.defaultValues" }}
 {{- if not .defaultValuesSet }}
   {{- $name := include "scp.fullname" . }}
+  {{- if and (not .Values.configSecret.enabled) (not .Values.configSecret.name) }}
+    {{- fail "configSecret.name is required when configSecret.enabled is false" }}
+  {{- end }}
   {{- with .Values }}
+    {{- $_ := set .certManager.certificate         "name" (.certManager.certificate.name         | default (printf "%s-server-tls" $name)) }}
+    {{- $_ := set .certManager.issuer              "name" (.certManager.issuer.name              | default (printf "%s-selfsigned" $name)) }}
+    {{- $_ := set .cloudNativePG.cluster           "name" (.cloudNativePG.cluster.name           | default (printf "%s-cnpg" $name)) }}
+    {{- $_ := set .prometheusOperator.prometheus   "name" (.prometheusOperator.prometheus.name   | default (printf "%s-prometheus" $name)) }}
+    {{- $_ := set .prometheusOperator.service      "name" (.prometheusOperator.service.name      | default (printf "%s-prometheus" $name)) }}
     {{- $_ := set .configSecret                    "name" (.configSecret.name                    | default (printf "%s-config" $name)) }}
     {{- $_ := set .deployment                      "name" (.deployment.name                      | default $name) }}
     {{- $_ := set .imagePullSecret                 "name" (.imagePullSecret.name                 | default (printf "%s-regcred" $name)) }}
     {{- $_ := set .ingress                         "name" (.ingress.name                         | default $name) }}
     {{- $_ := set .service                         "name" (.service.name                         | default $name) }}
+    {{- $_ := set .networkPolicy                   "name" (.networkPolicy.name                   | default $name) }}
     {{- $_ := set .serviceAccount                  "name" (.serviceAccount.name                  | default $name) }}
     {{- $_ := set .singleReplicaMode.encryptionPvc "name" (.singleReplicaMode.encryptionPvc.name | default (printf "%s-encryption" $name)) }}
     {{- $_ := set .singleReplicaMode.postgresPvc   "name" (.singleReplicaMode.postgresPvc.name   | default (printf "%s-postgres" $name)) }}
     {{- $_ := set .singleReplicaMode.prometheusPvc "name" (.singleReplicaMode.prometheusPvc.name | default (printf "%s-prometheus" $name)) }}
+    {{- with .singleReplicaMode.backup }}
+      {{- $_ := set .                              "name" (.name                                 | default (printf "%s-backup" $name)) }}
+      {{- $_ := set .serviceAccount                "name" (.serviceAccount.name                  | default (printf "%s-backup" $name)) }}
+      {{- $_ := set .role                          "name" (.role.name                            | default (printf "%s-backup" $name)) }}
+      {{- $_ := set .roleBinding                   "name" (.roleBinding.name                     | default (printf "%s-backup" $name)) }}
+    {{- end }}
+    {{- with .migration }}
+      {{- $_ := set .                              "name" (.name                                 | default (printf "%s-migration" $name)) }}
+      {{- $_ := set .scaleDown                     "name" (.scaleDown.name                       | default (printf "%s-migration-scale-down" $name)) }}
+      {{- $_ := set .scaleDown.serviceAccount      "name" (.scaleDown.serviceAccount.name        | default (printf "%s-migration-scale-down" $name)) }}
+      {{- $_ := set .scaleDown.role                "name" (.scaleDown.role.name                  | default (printf "%s-migration-scale-down" $name)) }}
+      {{- $_ := set .scaleDown.roleBinding         "name" (.scaleDown.roleBinding.name           | default (printf "%s-migration-scale-down" $name)) }}
+    {{- end }}
+    {{- $_ := set .test                            "name" (.test.name                            | default (printf "%s-test" $name)) }}
+  {{- end }}
+
+  {{- with .Values.container }}
+    {{- if kindIs "invalid" .resources }}
+      {{- if $.Values.singleReplicaMode.enabled }}
+        {{- $_ := set . "resources" (dict "requests" (dict "cpu" "500m" "memory" "1Gi") "limits" (dict "memory" "4Gi")) }}
+      {{- else }}
+        {{- $_ := set . "resources" (dict "requests" (dict "cpu" "250m" "memory" "256Mi") "limits" (dict "memory" "1Gi")) }}
+      {{- end }}
+    {{- end }}
+  {{- end }}
+
+  {{- with .Values.externalSecret }}
+    {{- if .enabled }}
+      {{- $_ := (.secretStoreRef.name | required "externalSecret.secretStoreRef.name is required") }}
+      {{- $_ := (.remoteRefs.dsn.key | required "externalSecret.remoteRefs.dsn.key is required") }}
+      {{- $dsnSecretRef := $.Values.config.dataSources.postgres.dsnSecretRef }}
+      {{- $_ := set $dsnSecretRef "name" ($dsnSecretRef.name | default (printf "%s-postgres-dsn" $name)) }}
+      {{- $_ := set . "name" (.name | default $dsnSecretRef.name) }}
+    {{- end }}
+  {{- end }}
+
+  {{- with .Values.certManager.certificate }}
+    {{- if .enabled }}
+      {{- $tls := $.Values.config.server.tls }}
+      {{- if not $tls.enabled }}
+        {{- fail "config.server.tls.enabled must be true when certManager.certificate is enabled" }}
+      {{- end }}
+      {{- if and (not .issuerRef.name) (not $.Values.certManager.issuer.enabled) }}
+        {{- fail "certManager.certificate.issuerRef.name must be set when certManager.issuer is disabled" }}
+      {{- end }}
+      {{- $_ := set . "secretName" (.secretName | default $tls.secretName | default .name) }}
+      {{- $_ := set $tls "secretName" .secretName }}
+    {{- end }}
+  {{- end }}
+
+  {{- with .Values.cloudNativePG.cluster }}
+    {{- if .enabled }}
+      {{- $postgres := $.Values.config.dataSources.postgres }}
+      {{- if or $postgres.dsn $postgres.dsnSecretRef.name }}
+        {{- fail "config.dataSources.postgres.dsn and config.dataSources.postgres.dsnSecretRef must not be set when cloudNativePG.cluster is enabled" }}
+      {{- end }}
+      {{- $_ := set $postgres "dsn" (printf "postgres://%s@%s-rw.%s.svc:5432/%s" .owner .name $.Release.Namespace .database) }}
+      {{- $_ := set $postgres.tls "enabled" true }}
+      {{- $_ := set $postgres.tls "secretName" (.serverCASecretName | default (printf "%s-ca" .name)) }}
+      {{- $_ := set $postgres.tls "ca" "ca.crt" }}
+    {{- end }}
+  {{- end }}
+
+  {{- with .Values.prometheusOperator.prometheus }}
+    {{- if .enabled }}
+      {{- $prometheus := $.Values.config.dataSources.prometheus }}
+      {{- if $prometheus.url }}
+        {{- fail "config.dataSources.prometheus.url must not be set when prometheusOperator.prometheus is enabled" }}
+      {{- end }}
+      {{- $service := $.Values.prometheusOperator.service }}
+      {{- $_ := set $prometheus "url" (printf "%s://%s.%s.svc:%d" (ternary "https" "http" (not (empty .tls.secretName))) $service.name $.Release.Namespace (int $service.port)) }}
+      {{- with .tls.secretName }}
+        {{- $_ := set $prometheus.tls "enabled" true }}
+        {{- $_ := set $prometheus.tls "secretName" . }}
+        {{- $_ := set $prometheus.tls "ca" "ca.crt" }}
+      {{- end }}
+    {{- end }}
   {{- end }}
 
   {{- $values := get (include "tplYaml" (dict "doc" .Values "ctx" $) | fromJson) "doc" }}
@@ -61,15 +147,133 @@ Set default values.
     {{- $_ := set $ "config" $config }}
   {{- end }}
 
+  {{- with .Values.config.dataSources.postgres }}
+    {{- if and .dsn .dsnSecretRef.name }}
+      {{- fail "config.dataSources.postgres.dsn and config.dataSources.postgres.dsnSecretRef cannot both be set" }}
+    {{- end }}
+  {{- end }}
+  {{- $postgresConfigured := false }}
+  {{- with .config.data_sources }}
+    {{- with .postgres }}
+      {{- $postgresConfigured = not (empty .dsn) }}
+    {{- end }}
+  {{- end }}
+
+  {{- with .Values.deployment }}
+    {{- with .strategy }}
+      {{- if and .type (not (has .type (list "Recreate" "RollingUpdate"))) }}
+        {{- fail (printf "deployment.strategy.type must be Recreate or RollingUpdate, got %s" .type) }}
+      {{- end }}
+      {{- with .rollingUpdate }}
+        {{- if eq ($.Values.deployment.strategy.type | default "RollingUpdate") "Recreate" }}
+          {{- fail "deployment.strategy.rollingUpdate must not be set when deployment.strategy.type is Recreate" }}
+        {{- end }}
+        {{- if and (has (toString (.maxSurge | default 0)) (list "0" "0%")) (has (toString (.maxUnavailable | default 0)) (list "0" "0%")) (or (hasKey . "maxSurge") (hasKey . "maxUnavailable")) }}
+          {{- fail "deployment.strategy.rollingUpdate.maxSurge and maxUnavailable must not both be 0" }}
+        {{- end }}
+      {{- end }}
+    {{- end }}
+    {{- range $k := list "minReadySeconds" "revisionHistoryLimit" "progressDeadlineSeconds" }}
+      {{- if lt (int (get $.Values.deployment $k)) 0 }}
+        {{- fail (printf "deployment.%s must not be negative" $k) }}
+      {{- end }}
+    {{- end }}
+    {{- if and .progressDeadlineSeconds (le (int .progressDeadlineSeconds) (int .minReadySeconds)) }}
+      {{- fail "deployment.progressDeadlineSeconds must be greater than deployment.minReadySeconds" }}
+    {{- end }}
+  {{- end }}
+
+  {{- with .Values.migration }}
+    {{- if and .enabled (not .args) }}
+      {{- fail "migration.args is required when migration is enabled" }}
+    {{- end }}
+  {{- end }}
+
+  {{- /* config is only validated when the chart generates the config secret, the contents of an existing secret are unknown */}}
   {{- if .Values.singleReplicaMode.enabled }}
     {{- if gt (int .Values.deployment.replicas) 1 }}
       {{- fail "deployment.replicas must be 1 when singleReplicaMode is enabled" }}
     {{- end }}
-  {{- else }}
+    {{- with .Values.deployment }}
+      {{- if $.Values.singleReplicaMode.statefulSet.enabled }}
+        {{- if .strategy }}
+          {{- fail "deployment.strategy is not supported when singleReplicaMode.statefulSet is enabled, use singleReplicaMode.statefulSet.updateStrategy" }}
+        {{- end }}
+        {{- if not (kindIs "invalid" .progressDeadlineSeconds) }}
+          {{- fail "deployment.progressDeadlineSeconds is not supported when singleReplicaMode.statefulSet is enabled" }}
+        {{- end }}
+      {{- else }}
+        {{- if not .strategy }}
+          {{- $_ := set . "strategy" (dict "type" "Recreate") }}
+        {{- end }}
+        {{- $readWriteOnce := false }}
+        {{- range (include "scp.pvcs" $ | fromJson).pvcs }}
+          {{- range .pvc.accessModes }}
+            {{- if has . (list "ReadWriteOnce" "ReadWriteOncePod") }}
+              {{- $readWriteOnce = true }}
+            {{- end }}
+          {{- end }}
+        {{- end }}
+        {{- if and $readWriteOnce (ne (.strategy.type | default "RollingUpdate") "Recreate") }}
+          {{- fail "deployment.strategy.type must be Recreate when singleReplicaMode PVCs use ReadWriteOnce or ReadWriteOncePod" }}
+        {{- end }}
+      {{- end }}
+    {{- end }}
+    {{- with .Values.singleReplicaMode.backup }}
+      {{- if .enabled }}
+        {{- if not (include "scp.backupPvcs" $) }}
+          {{- fail "singleReplicaMode.backup requires at least one enabled PVC" }}
+        {{- end }}
+        {{- if lt (int .retention) 1 }}
+          {{- fail "singleReplicaMode.backup.retention must be at least 1" }}
+        {{- end }}
+      {{- end }}
+    {{- end }}
+    {{- range (include "scp.pvcs" $ | fromJson).pvcs }}
+      {{- $key := printf "singleReplicaMode.%sPvc" .volume }}
+      {{- $claimName := .claimName }}
+      {{- with .pvc }}
+        {{- $bytes := include "scp.quantityBytes" .size }}
+        {{- if not $bytes }}
+          {{- fail (printf "%s.size must be a quantity like 10Gi, got %v" $key .size) }}
+        {{- end }}
+        {{- if not .accessModes }}
+          {{- fail (printf "%s.accessModes must not be empty" $key) }}
+        {{- end }}
+        {{- range .accessModes }}
+          {{- if not (has . (list "ReadWriteOnce" "ReadOnlyMany" "ReadWriteMany" "ReadWriteOncePod")) }}
+            {{- fail (printf "%s.accessModes must be ReadWriteOnce, ReadOnlyMany, ReadWriteMany or ReadWriteOncePod, got %s" $key .) }}
+          {{- end }}
+        {{- end }}
+        {{- if and .volumeMode (ne .volumeMode "Filesystem") }}
+          {{- fail (printf "%s.volumeMode must be Filesystem, got %s" $key .volumeMode) }}
+        {{- end }}
+        {{- with .dataSource }}
+          {{- if or (not .kind) (not .name) }}
+            {{- fail (printf "%s.dataSource.kind and name are required if dataSource is set" $key) }}
+          {{- end }}
+        {{- end }}
+        {{- /* lookup returns an empty dict during helm template and --dry-run, so this is only checked on install and upgrade */}}
+        {{- with lookup "v1" "PersistentVolumeClaim" $.Release.Namespace $claimName }}
+          {{- $current := .spec.resources.requests.storage }}
+          {{- if lt (float64 $bytes) (float64 (include "scp.quantityBytes" $current)) }}
+            {{- fail (printf "%s.size must not be smaller than the size %s of the existing PVC %s, PVCs can only grow" $key $current $claimName) }}
+          {{- end }}
+        {{- end }}
+      {{- end }}
+    {{- end }}
+    {{- if .Values.singleReplicaMode.statefulSet.enabled }}
+      {{- with lookup "apps/v1" "StatefulSet" $.Release.Namespace .Values.deployment.name }}
+        {{- with include "scp.volumeClaimTemplateChanges" (dict "ctx" $ "statefulSet" .) }}
+          {{- fail . }}
+        {{- end }}
+      {{- end }}
+    {{- end }}
+  {{- else if .Values.configSecret.enabled }}
     {{- if or (not .config.kms) (not .config.kms.key_url) }}
       {{- fail "config.kms.key must configured singleReplicaMode is disabled" }}
     {{- end }}
-    {{- if or (not .config.data_sources) (not .config.data_sources.postgres) (not .config.data_sources.postgres.dsn) }}
+    {{- if not $postgresConfigured }}
       {{- fail "config.dataSources.postgres must be configured when singleReplicaMode is disabled" }}
     {{- end }}
     {{- if or (not .config.data_sources) (not .config.data_sources.prometheus) (not .config.data_sources.prometheus.url) }}
@@ -77,9 +281,46 @@ Set default values.
     {{- end }}
   {{- end }}
 
-  {{- if .Values.container.image.slim }}
-    {{- if or (not .config.data_sources) (not .config.data_sources.postgres) (not .config.data_sources.postgres.dsn) }}
-      {{- fail "config.dataSources.postgres must be configured when container.image.slim=true" }}
+  {{- if .Values.configSecret.enabled }}
+    {{- /* every file:// URL in the config must point into a mounted volume, data_dir itself is an emptyDir */}}
+    {{- $mountDirs := list }}
+    {{- range (include "scp.pvcs" . | fromJson).pvcs }}
+      {{- $mountDirs = append $mountDirs (printf "%s/%s" (trimSuffix "/" $.config.data_dir) .volume) }}
+    {{- end }}
+    {{- range (include "scp.secretNames" . | fromJson).secretNames }}
+      {{- $mountDirs = append $mountDirs (trimSuffix "/" .dir) }}
+    {{- end }}
+    {{- range .Values.container.extraVolumeMounts }}
+      {{- $mountDirs = append $mountDirs (trimSuffix "/" .mountPath) }}
+    {{- end }}
+    {{- $fileUrls := list }}
+    {{- with .config.kms }}
+      {{- with .key_url }}
+        {{- $fileUrls = append $fileUrls . }}
+      {{- end }}
+      {{- with .rotated_key_urls }}
+        {{- $fileUrls = concat $fileUrls . }}
+      {{- end }}
+    {{- end }}
+    {{- range $url := $fileUrls }}
+      {{- if hasPrefix "file://" $url }}
+        {{- $path := trimPrefix "file://" $url }}
+        {{- $mounted := false }}
+        {{- range $dir := $mountDirs }}
+          {{- if hasPrefix (printf "%s/" $dir) $path }}
+            {{- $mounted = true }}
+          {{- end }}
+        {{- end }}
+        {{- if not $mounted }}
+          {{- fail (printf "config.kms URL %s does not resolve to a mounted volume; set secretName on the key, mount it with container.extraVolumeMounts or use a path in a singleReplicaMode PVC" $url) }}
+        {{- end }}
+      {{- end }}
+    {{- end }}
+
+    {{- if .Values.container.image.slim }}
+      {{- if not $postgresConfigured }}
+        {{- fail "config.dataSources.postgres must be configured when container.image.slim=true" }}
+      {{- end }}
     {{- end }}
   {{- end }}
 
@@ -119,9 +360,24 @@ Print the image
 {{- if .slim }}
 {{- $tag = ternary "slim" (printf "%s-slim" $tag) (eq $tag "latest") }}
 {{- end -}}
-{{- $image := printf "%s:%s" .repository $tag }}
-{{- if or .registry .imagePullSecret.enabled .global.image.registry }}
-{{- $image = printf "%s/%s" (.registry | default (ternary .imagePullSecret.registry .global.image.registry .imagePullSecret.enabled)) $image }}
+{{- $image := .repository }}
+{{- with $tag }}
+{{- $image = printf "%s:%s" $image . }}
+{{- end }}
+{{- with .digest }}
+{{- if not (regexMatch "^sha256:[a-f0-9]{64}$" .) }}
+{{- fail (printf "%s image digest %s must match sha256:[a-f0-9]{64}" $.repository .) }}
+{{- end }}
+{{- $image = printf "%s@%s" $image . }}
+{{- end }}
+{{- $defaultRegistry := .global.image.registry }}
+{{- with .imagePullSecret }}
+{{- if .enabled }}
+{{- $defaultRegistry = .registry }}
+{{- end }}
+{{- end }}
+{{- with .registry | default $defaultRegistry }}
+{{- $image = printf "%s/%s" . $image }}
 {{- end -}}
 image: {{ $image }}
 {{- if or .pullPolicy .global.image.pullPolicy }}
@@ -129,6 +385,123 @@ imagePullPolicy: {{ .pullPolicy | default .global.image.pullPolicy }}
 {{- end }}
 {{- end }}
 
+{{/*
+Ports from a list of URLs, each item may be a comma separated list of URLs
+*/}}
+{{- define "scp.urlPorts" -}}
+{{- $ports := list }}
+{{- $defaults := dict "nats" 4222 "tls" 4222 "ws" 80 "wss" 443 "http" 80 "https" 443 "postgres" 5432 "postgresql" 5432 }}
+{{- range $urls := . }}
+  {{- range $url := splitList "," $urls }}
+    {{- $url = trim $url }}
+    {{- if $url }}
+      {{- if not (contains "://" $url) }}
+        {{- $url = printf "nats://%s" $url }}
+      {{- end }}
+      {{- $u := urlParse $url }}
+      {{- $port := regexFind "[0-9]+$" (regexFind ":[0-9]+$" $u.host) }}
+      {{- if not $port }}
+        {{- if not (hasKey $defaults $u.scheme) }}
+          {{- fail (printf "unable to determine the port of URL %s" $url) }}
+        {{- end }}
+        {{- $port = get $defaults $u.scheme }}
+      {{- end }}
+      {{- if not (has (int $port) $ports) }}
+        {{- $ports = append $ports (int $port) }}
+      {{- end }}
+    {{- end }}
+  {{- end }}
+{{- end }}
+{{- toJson (dict "ports" $ports) }}
+{{- end }}
+
+{{/*
+Volumes managed by the chart
+*/}}
+{{- define "scp.volumes" -}}
+# config secret
+- name: config
+  secret:
+    secretName: {{ .Values.configSecret.name }}
+{{- if .Values.config.dataSources.postgres.dsnSecretRef.name }}
+# syn-cp.yaml rendered from config.dataSources.postgres.dsnSecretRef
+- name: config-rendered
+  emptyDir:
+    medium: Memory
+{{- end }}
+# data emptyDir
+- name: data
+  emptyDir: {}
+# Single Replica Mode PVCs
+{{- range (include "scp.pvcs" $ | fromJson).pvcs }}
+- name: {{ .volume }}
+  persistentVolumeClaim:
+    claimName: {{ .claimName | quote }}
+{{- end }}
+# external secrets
+{{- range (include "scp.secretNames" $ | fromJson).secretNames }}
+- name: {{ .name | quote }}
+  secret:
+    secretName: {{ .secretName | quote }}
+{{- end }}
+
+{{- end }}
+
+{{/*
+Fail if a user provided list has names that collide with names managed by the chart, or with each other
+*/}}
+{{- define "scp.checkNames" -}}
+{{- $names := list }}
+{{- range .reserved }}
+  {{- $names = append $names .name }}
+{{- end }}
+{{- range .items }}
+  {{- if not .name }}
+    {{- fail (printf "%s entries require a name" $.key) }}
+  {{- end }}
+  {{- if has .name $names }}
+    {{- fail (printf "%s name %s collides with an existing name" $.key .name) }}
+  {{- end }}
+  {{- $names = append $names .name }}
+{{- end }}
+{{- end }}
+
+{{/*
+Enabled container probes
+*/}}
+{{- define "scp.probes" -}}
+{{- range $name, $probe := .Values.container.probes }}
+{{- if $probe.enabled }}
+{{ $name }}Probe:
+  {{- omit $probe "enabled" | toYaml | nindent 2 }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{/*
+GOMEMLIMIT in bytes derived from container.resources.limits.memory
+*/}}
+{{- define "scp.goMemLimit" -}}
+{{- with .Values.container }}
+{{- if and .goMemLimit.enabled (not (hasKey (.env | default dict) "GOMEMLIMIT")) }}
+  {{- $memory := (.resources | default dict).limits | default dict | dig "memory" "" }}
+  {{- if not $memory }}
+    {{- fail "container.resources.limits.memory is required when container.goMemLimit is enabled" }}
+  {{- end }}
+  {{- if not (kindIs "string" $memory) }}
+    {{- $memory = int64 $memory | toString }}
+  {{- end }}
+  {{- $units := dict "" 1 "k" 1000 "M" 1000000 "G" 1000000000 "T" 1000000000000 "Ki" 1024 "Mi" 1048576 "Gi" 1073741824 "Ti" 1099511627776 }}
+  {{- $value := regexFind "^[0-9]+" $memory }}
+  {{- $unit := trimPrefix $value $memory }}
+  {{- if or (not $value) (not (hasKey $units $unit)) }}
+    {{- fail (cat "container.resources.limits.memory" $memory "can not be used for container.goMemLimit") }}
+  {{- end }}
+  {{- div (mul (atoi $value) (get $units $unit) .goMemLimit.percent) 100 }}
+{{- end }}
+{{- end }}
+{{- end }}
+
 {{/*
 List of external secretNames
 */}}
@@ -141,16 +514,14 @@ List of external secretNames
       {{- end }}
     {{- end }}
     {{- with .kms }}
-      {{- if .enabled }}
-        {{- with .key }}
-          {{- if .secretName }}
-            {{- $secrets = append $secrets (merge (dict "name" "kms-key") .) }}
-          {{- end }}
+      {{- with .key }}
+        {{- if .secretName }}
+          {{- $secrets = append $secrets (merge (dict "name" "kms-key") .) }}
         {{- end }}
-        {{- range $k, $v := .rotatedKeys }}
-          {{- if $v.secretName }}
-            {{- $secrets = append $secrets (merge (dict "name" (printf "kms-rotated-key-%d" $k)) $v) }}
-          {{- end }}
+      {{- end }}
+      {{- range $k, $v := .rotatedKeys }}
+        {{- if $v.secretName }}
+          {{- $secrets = append $secrets (merge (dict "name" (printf "kms-rotated-key-%d" $k)) $v) }}
         {{- end }}
       {{- end }}
     {{- end }}
@@ -168,6 +539,169 @@ List of external secretNames
 {{- toJson (dict "secretNames" $secrets) }}
 {{- end }}
 
+{{/*
+Enabled single replica mode PVCs as JSON
+each entry has the volume name, the PVC values, and the name of the PVC claimed by the pod
+in StatefulSet mode the PVCs are created from volumeClaimTemplates named after the volume
+*/}}
+{{- define "scp.pvcs" -}}
+{{- $pvcs := list }}
+{{- with .Values.singleReplicaMode }}
+  {{- if .enabled }}
+    {{- range $volume, $pvc := dict "encryption" .encryptionPvc "postgres" .postgresPvc "prometheus" .prometheusPvc }}
+      {{- if $pvc.enabled }}
+        {{- $claimName := $pvc.name }}
+        {{- if $.Values.singleReplicaMode.statefulSet.enabled }}
+          {{- $claimName = printf "%s-%s-0" $volume $.Values.deployment.name }}
+        {{- end }}
+        {{- $pvcs = append $pvcs (dict "volume" $volume "claimName" $claimName "pvc" $pvc) }}
+      {{- end }}
+    {{- end }}
+  {{- end }}
+{{- end }}
+{{- toJson (dict "pvcs" $pvcs) }}
+{{- end }}
+
+{{/*
+Error message if the single replica mode PVCs differ from the volumeClaimTemplates of an existing StatefulSet,
+empty if they match
+*/}}
+{{- define "scp.volumeClaimTemplateChanges" -}}
+{{- $ctx := .ctx }}
+{{- $current := dict }}
+{{- range .statefulSet.spec.volumeClaimTemplates }}
+  {{- $_ := set $current .metadata.name .spec }}
+{{- end }}
+{{- $changes := list }}
+{{- $volumes := list }}
+{{- range (include "scp.pvcs" $ctx | fromJson).pvcs }}
+  {{- $key := printf "singleReplicaMode.%sPvc" .volume }}
+  {{- $volumes = append $volumes .volume }}
+  {{- $spec := get $current .volume }}
+  {{- if not $spec }}
+    {{- $changes = append $changes (printf "%s was enabled" $key) }}
+  {{- else }}
+    {{- with .pvc }}
+      {{- $size := $spec.resources.requests.storage }}
+      {{- if ne (include "scp.quantityBytes" .size) (include "scp.quantityBytes" $size) }}
+        {{- $changes = append $changes (printf "%s.size changed from %s to %v" $key $size .size) }}
+      {{- end }}
+      {{- $storageClassName := $spec.storageClassName | default "" }}
+      {{- if ne (toString (.storageClassName | default "")) $storageClassName }}
+        {{- $changes = append $changes (printf "%s.storageClassName changed from %q to %q" $key $storageClassName (toString (.storageClassName | default ""))) }}
+      {{- end }}
+      {{- if ne (toJson .accessModes) (toJson $spec.accessModes) }}
+        {{- $changes = append $changes (printf "%s.accessModes changed from %s to %s" $key (join "," $spec.accessModes) (join "," .accessModes)) }}
+      {{- end }}
+    {{- end }}
+  {{- end }}
+{{- end }}
+{{- range $volume, $_ := $current }}
+  {{- if not (has $volume $volumes) }}
+    {{- $changes = append $changes (printf "singleReplicaMode.%sPvc was disabled" $volume) }}
+  {{- end }}
+{{- end }}
+{{- with $changes }}
+  {{- printf "volumeClaimTemplates of the existing StatefulSet %s can not be changed (%s), delete the StatefulSet with kubectl delete --cascade=orphan before helm upgrade, see the README" $ctx.Values.deployment.name (join ", " .) }}
+{{- end }}
+{{- end }}
+
+{{/*
+Number of bytes in a Kubernetes resource quantity, empty if the quantity is not supported
+*/}}
+{{- define "scp.quantityBytes" -}}
+{{- $quantity := toString . }}
+{{- $suffix := regexFind "[a-zA-Z]+$" $quantity }}
+{{- $number := trimSuffix $suffix $quantity }}
+{{- $exponents := dict "" 0 "k" 1 "M" 2 "G" 3 "T" 4 "P" 5 "E" 6 "Ki" 1 "Mi" 2 "Gi" 3 "Ti" 4 "Pi" 5 "Ei" 6 }}
+{{- if and (regexMatch "^[0-9]+(\\.[0-9]+)?$" $number) (hasKey $exponents $suffix) }}
+  {{- $base := ternary 1024 1000 (hasSuffix "i" $suffix) }}
+  {{- $bytes := float64 $number }}
+  {{- range until (int (get $exponents $suffix)) }}
+    {{- $bytes = mulf $bytes $base }}
+  {{- end }}
+  {{- printf "%.0f" $bytes }}
+{{- end }}
+{{- end }}
+
+{{/*
+Space separated list of single replica mode PVCs to back up
+*/}}
+{{- define "scp.backupPvcs" -}}
+{{- $pvcs := list }}
+{{- range (include "scp.pvcs" $ | fromJson).pvcs }}
+  {{- $pvcs = append $pvcs .claimName }}
+{{- end }}
+{{- join " " $pvcs }}
+{{- end }}
+
+{{/*
+Postgres TLS connection parameters
+*/}}
+{{- define "scp.postgresTlsParams" -}}
+{{- $params := list }}
+  {{- with .Values.config.dataSources.postgres.tls }}
+    {{- if and .enabled .addToDsn }}
+      {{- $params = append $params (dict "key" "sslmode" "value" .addToDsnSslMode) }}
+      {{- if .secretName }}
+        {{- $dir := trimSuffix "/" .dir }}
+        {{- if and .cert .key }}
+          {{- $params = append $params (dict "key" "sslcert" "value" (printf "%s/%s" $dir .cert)) }}
+          {{- $params = append $params (dict "key" "sslkey" "value" (printf "%s/%s" $dir .key)) }}
+        {{- end }}
+        {{- if .ca }}
+          {{- $params = append $params (dict "key" "sslrootcert" "value" (printf "%s/%s" $dir .ca)) }}
+        {{- end }}
+      {{- end }}
+    {{- end }}
+  {{- end }}
+{{- toJson (dict "params" $params) }}
+{{- end }}
+
+{{/*
+Image pull secrets for all pod specs, the generated imagePullSecret followed by global.image.pullSecretNames
+*/}}
+{{- define "scp.imagePullSecrets" -}}
+{{- $names := list }}
+{{- if .Values.imagePullSecret.enabled }}
+  {{- $names = append $names .Values.imagePullSecret.name }}
+{{- end }}
+{{- $names = concat $names (.Values.global.image.pullSecretNames | default list) | uniq }}
+{{- with $names }}
+imagePullSecrets:
+{{- range . }}
+- name: {{ . | quote }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{/*
+Pod scheduling options, podTemplate options override global.podTemplate options
+*/}}
+{{- define "scp.scheduling" -}}
+{{- $global := .Values.global.podTemplate }}
+{{- with .Values.podTemplate }}
+{{- with .nodeSelector | default $global.nodeSelector }}
+nodeSelector:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .tolerations | default $global.tolerations }}
+tolerations:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .affinity | default $global.affinity }}
+affinity:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .priorityClassName | default $global.priorityClassName }}
+priorityClassName: {{ . | quote }}
+{{- end }}
+{{- with .runtimeClassName | default $global.runtimeClassName }}
+runtimeClassName: {{ . | quote }}
+{{- end }}
+{{- end }}
+{{- end }}
+
 {{/*
 Translates env var map to list
 */}}
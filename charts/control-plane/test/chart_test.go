@@ -12,21 +12,39 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 type Resources struct {
 	Conf                           Resource[map[string]any]
+	Certificate                    Resource[map[string]any]
+	CloudNativePGCluster           Resource[map[string]any]
 	ConfigSecret                   Resource[corev1.Secret]
 	Deployment                     Resource[appsv1.Deployment]
+	ExternalSecret                 Resource[map[string]any]
 	ImagePullSecret                Resource[corev1.Secret]
 	Ingress                        Resource[networkingv1.Ingress]
+	Issuer                         Resource[map[string]any]
+	NetworkPolicy                  Resource[networkingv1.NetworkPolicy]
+	Prometheus                     Resource[map[string]any]
+	PrometheusService              Resource[corev1.Service]
 	Service                        Resource[corev1.Service]
 	ServiceAccount                 Resource[corev1.ServiceAccount]
 	SingleReplicaModeEncryptionPvc Resource[corev1.PersistentVolumeClaim]
 	SingleReplicaModePostgresPvc   Resource[corev1.PersistentVolumeClaim]
 	SingleReplicaModePrometheusPvc Resource[corev1.PersistentVolumeClaim]
+	StatefulSet                    Resource[appsv1.StatefulSet]
+	BackupCronJob                  Resource[batchv1.CronJob]
+	BackupRole                     Resource[rbacv1.Role]
+	BackupRoleBinding              Resource[rbacv1.RoleBinding]
+	BackupServiceAccount           Resource[corev1.ServiceAccount]
+	MigrationConfigSecret          Resource[corev1.Secret]
+	MigrationJob                   Resource[batchv1.Job]
+	MigrationScaleDownJob          Resource[batchv1.Job]
+	TestPod                        Resource[corev1.Pod]
 	ExtraConfigMap                 Resource[corev1.ConfigMap]
 	ExtraService                   Resource[corev1.Service]
 }
@@ -34,15 +52,31 @@ type Resources struct {
 func (r *Resources) Iter() []MutableResource {
 	return []MutableResource{
 		r.Conf.Mutable(),
+		r.Certificate.Mutable(),
+		r.CloudNativePGCluster.Mutable(),
 		r.ConfigSecret.Mutable(),
 		r.Deployment.Mutable(),
+		r.ExternalSecret.Mutable(),
 		r.ImagePullSecret.Mutable(),
 		r.Ingress.Mutable(),
+		r.Issuer.Mutable(),
+		r.NetworkPolicy.Mutable(),
+		r.Prometheus.Mutable(),
+		r.PrometheusService.Mutable(),
 		r.Service.Mutable(),
 		r.ServiceAccount.Mutable(),
 		r.SingleReplicaModeEncryptionPvc.Mutable(),
 		r.SingleReplicaModePostgresPvc.Mutable(),
 		r.SingleReplicaModePrometheusPvc.Mutable(),
+		r.StatefulSet.Mutable(),
+		r.BackupCronJob.Mutable(),
+		r.BackupRole.Mutable(),
+		r.BackupRoleBinding.Mutable(),
+		r.BackupServiceAccount.Mutable(),
+		r.MigrationConfigSecret.Mutable(),
+		r.MigrationJob.Mutable(),
+		r.MigrationScaleDownJob.Mutable(),
+		r.TestPod.Mutable(),
 		r.ExtraConfigMap.Mutable(),
 		r.ExtraService.Mutable(),
 	}
@@ -82,18 +116,39 @@ func GenerateResources(fullName string) *Resources {
 		Conf: Resource[map[string]any]{
 			ID: "syn-cp.yaml",
 		},
+		Certificate: Resource[map[string]any]{
+			ID: "Certificate/" + fullName + "-server-tls",
+		},
+		CloudNativePGCluster: Resource[map[string]any]{
+			ID: "Cluster/" + fullName + "-cnpg",
+		},
 		ConfigSecret: Resource[corev1.Secret]{
 			ID: "Secret/" + fullName + "-config",
 		},
 		Deployment: Resource[appsv1.Deployment]{
 			ID: "Deployment/" + fullName,
 		},
+		ExternalSecret: Resource[map[string]any]{
+			ID: "ExternalSecret/" + fullName + "-postgres-dsn",
+		},
 		ImagePullSecret: Resource[corev1.Secret]{
 			ID: "Secret/" + fullName + "-regcred",
 		},
 		Ingress: Resource[networkingv1.Ingress]{
 			ID: "Ingress/" + fullName,
 		},
+		Issuer: Resource[map[string]any]{
+			ID: "Issuer/" + fullName + "-selfsigned",
+		},
+		NetworkPolicy: Resource[networkingv1.NetworkPolicy]{
+			ID: "NetworkPolicy/" + fullName,
+		},
+		Prometheus: Resource[map[string]any]{
+			ID: "Prometheus/" + fullName + "-prometheus",
+		},
+		PrometheusService: Resource[corev1.Service]{
+			ID: "Service/" + fullName + "-prometheus",
+		},
 		Service: Resource[corev1.Service]{
 			ID: "Service/" + fullName,
 		},
@@ -109,6 +164,33 @@ func GenerateResources(fullName string) *Resources {
 		SingleReplicaModePrometheusPvc: Resource[corev1.PersistentVolumeClaim]{
 			ID: "PersistentVolumeClaim/" + fullName + "-prometheus",
 		},
+		StatefulSet: Resource[appsv1.StatefulSet]{
+			ID: "StatefulSet/" + fullName,
+		},
+		BackupCronJob: Resource[batchv1.CronJob]{
+			ID: "CronJob/" + fullName + "-backup",
+		},
+		BackupRole: Resource[rbacv1.Role]{
+			ID: "Role/" + fullName + "-backup",
+		},
+		BackupRoleBinding: Resource[rbacv1.RoleBinding]{
+			ID: "RoleBinding/" + fullName + "-backup",
+		},
+		BackupServiceAccount: Resource[corev1.ServiceAccount]{
+			ID: "ServiceAccount/" + fullName + "-backup",
+		},
+		MigrationConfigSecret: Resource[corev1.Secret]{
+			ID: "Secret/" + fullName + "-migration-config",
+		},
+		MigrationJob: Resource[batchv1.Job]{
+			ID: "Job/" + fullName + "-migration",
+		},
+		MigrationScaleDownJob: Resource[batchv1.Job]{
+			ID: "Job/" + fullName + "-migration-scale-down",
+		},
+		TestPod: Resource[corev1.Pod]{
+			ID: "Pod/" + fullName + "-test",
+		},
 		ExtraConfigMap: Resource[corev1.ConfigMap]{
 			ID: "ConfigMap/" + fullName + "-extra",
 		},
@@ -136,7 +218,7 @@ func DefaultTest() *Test {
 	}
 }
 
-func HelmRender(t *testing.T, test *Test) *Resources {
+func HelmRenderE(t *testing.T, test *Test) (string, error) {
 	t.Helper()
 
 	helmChartPath, err := filepath.Abs("..")
@@ -157,7 +239,14 @@ func HelmRender(t *testing.T, test *Test) *Resources {
 		ValuesFiles:    []string{tmpFile.Name()},
 		KubectlOptions: k8s.NewKubectlOptions("", "", test.Namespace),
 	}
-	output := helm.RenderTemplate(t, options, helmChartPath, test.ReleaseName, nil)
+	return helm.RenderTemplateE(t, options, helmChartPath, test.ReleaseName, nil)
+}
+
+func HelmRender(t *testing.T, test *Test) *Resources {
+	t.Helper()
+
+	output, err := HelmRenderE(t, test)
+	require.NoError(t, err)
 	outputs := strings.Split(output, "---")
 
 	resources := GenerateResources("control-plane")
@@ -176,13 +265,14 @@ func HelmRender(t *testing.T, test *Test) *Resources {
 		}
 	}
 
-	require.True(t, resources.ConfigSecret.HasValue)
-	confStr, ok := resources.ConfigSecret.Value.StringData["syn-cp.yaml"]
-	require.True(t, ok)
+	if resources.ConfigSecret.HasValue {
+		confStr, ok := resources.ConfigSecret.Value.StringData["syn-cp.yaml"]
+		require.True(t, ok)
 
-	err = yaml.Unmarshal([]byte(confStr), &resources.Conf.Value)
-	require.NoError(t, err)
-	resources.Conf.HasValue = true
+		err = yaml.Unmarshal([]byte(confStr), &resources.Conf.Value)
+		require.NoError(t, err)
+		resources.Conf.HasValue = true
+	}
 
 	return resources
 }
@@ -8,8 +8,10 @@ import (
 
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -73,6 +75,13 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 			"helm.sh/chart":                dd.HelmChartLabel,
 		}
 	}
+	cpLabelsAny := func() map[string]any {
+		labels := map[string]any{}
+		for k, v := range cpLabels() {
+			labels[k] = v
+		}
+		return labels
+	}
 	cpSelectorLabels := func() map[string]string {
 		return map[string]string{
 			"app.kubernetes.io/component": "control-plane",
@@ -80,11 +89,24 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 			"app.kubernetes.io/name":      chartName,
 		}
 	}
+	backupLabels := func() map[string]string {
+		labels := cpLabels()
+		labels["app.kubernetes.io/component"] = "control-plane-backup"
+		return labels
+	}
+	testLabels := func() map[string]string {
+		labels := cpLabels()
+		labels["app.kubernetes.io/component"] = "control-plane-test"
+		return labels
+	}
 
 	resource1Gi, _ := resource.ParseQuantity("1Gi")
 	resource10Gi, _ := resource.ParseQuantity("10Gi")
 	replicas1 := int32(1)
 	falseBool := false
+	trueBool := true
+	backoffLimit2 := int32(2)
+	runAsUser1000 := int64(1000)
 	prefixPath := networkingv1.PathTypePrefix
 	fsGroup := int64(1000)
 	fsGroupChangePolicy := corev1.FSGroupChangeOnRootMismatch
@@ -100,6 +122,50 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 				},
 			},
 		},
+		Certificate: Resource[map[string]any]{
+			ID:       dr.Certificate.ID,
+			HasValue: false,
+			Value: map[string]any{
+				"apiVersion": "cert-manager.io/v1",
+				"kind":       "Certificate",
+				"metadata": map[string]any{
+					"name":   fullName + "-server-tls",
+					"labels": cpLabelsAny(),
+				},
+				"spec": map[string]any{
+					"secretName": fullName + "-server-tls",
+					"issuerRef": map[string]any{
+						"name":  fullName + "-selfsigned",
+						"kind":  "Issuer",
+						"group": "cert-manager.io",
+					},
+				},
+			},
+		},
+		CloudNativePGCluster: Resource[map[string]any]{
+			ID:       dr.CloudNativePGCluster.ID,
+			HasValue: false,
+			Value: map[string]any{
+				"apiVersion": "postgresql.cnpg.io/v1",
+				"kind":       "Cluster",
+				"metadata": map[string]any{
+					"name":   fullName + "-cnpg",
+					"labels": cpLabelsAny(),
+				},
+				"spec": map[string]any{
+					"instances": float64(3),
+					"storage": map[string]any{
+						"size": "10Gi",
+					},
+					"bootstrap": map[string]any{
+						"initdb": map[string]any{
+							"database": "syn_cp",
+							"owner":    "syn_cp",
+						},
+					},
+				},
+			},
+		},
 		ConfigSecret: Resource[corev1.Secret]{
 			ID:       dr.ConfigSecret.ID,
 			HasValue: true,
@@ -177,6 +243,25 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 											},
 										},
 									},
+									ReadinessProbe: &corev1.Probe{
+										PeriodSeconds:    10,
+										FailureThreshold: 3,
+										ProbeHandler: corev1.ProbeHandler{
+											HTTPGet: &corev1.HTTPGetAction{
+												Path: "/healthz",
+												Port: intstr.FromString("http"),
+											},
+										},
+									},
+									Resources: corev1.ResourceRequirements{
+										Requests: corev1.ResourceList{
+											corev1.ResourceCPU:    resource.MustParse("500m"),
+											corev1.ResourceMemory: resource.MustParse("1Gi"),
+										},
+										Limits: corev1.ResourceList{
+											corev1.ResourceMemory: resource.MustParse("4Gi"),
+										},
+									},
 									VolumeMounts: []corev1.VolumeMount{
 										{
 											MountPath: "/etc/syn-cp",
@@ -256,6 +341,28 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 				},
 			},
 		},
+		ExternalSecret: Resource[map[string]any]{
+			ID:       dr.ExternalSecret.ID,
+			HasValue: false,
+			Value: map[string]any{
+				"apiVersion": "external-secrets.io/v1beta1",
+				"kind":       "ExternalSecret",
+				"metadata": map[string]any{
+					"name":   fullName + "-postgres-dsn",
+					"labels": cpLabelsAny(),
+				},
+				"spec": map[string]any{
+					"refreshInterval": "1h",
+					"secretStoreRef": map[string]any{
+						"kind": "SecretStore",
+					},
+					"target": map[string]any{
+						"name":           fullName + "-postgres-dsn",
+						"creationPolicy": "Owner",
+					},
+				},
+			},
+		},
 		ImagePullSecret: Resource[corev1.Secret]{
 			ID:       dr.ConfigSecret.ID,
 			HasValue: true,
@@ -314,6 +421,124 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 				},
 			},
 		},
+		Issuer: Resource[map[string]any]{
+			ID:       dr.Issuer.ID,
+			HasValue: false,
+			Value: map[string]any{
+				"apiVersion": "cert-manager.io/v1",
+				"kind":       "Issuer",
+				"metadata": map[string]any{
+					"name":   fullName + "-selfsigned",
+					"labels": cpLabelsAny(),
+				},
+				"spec": map[string]any{
+					"selfSigned": map[string]any{},
+				},
+			},
+		},
+		NetworkPolicy: Resource[networkingv1.NetworkPolicy]{
+			ID:       dr.NetworkPolicy.ID,
+			HasValue: false,
+			Value: networkingv1.NetworkPolicy{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "NetworkPolicy",
+					APIVersion: "networking.k8s.io/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: cpLabels(),
+				},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: v1.LabelSelector{
+						MatchLabels: cpSelectorLabels(),
+					},
+					PolicyTypes: []networkingv1.PolicyType{
+						networkingv1.PolicyTypeIngress,
+						networkingv1.PolicyTypeEgress,
+					},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{
+						{
+							Ports: []networkingv1.NetworkPolicyPort{
+								networkPolicyPort(corev1.ProtocolTCP, intstr.FromString("http")),
+							},
+						},
+					},
+					Egress: []networkingv1.NetworkPolicyEgressRule{
+						{
+							Ports: []networkingv1.NetworkPolicyPort{
+								networkPolicyPort(corev1.ProtocolUDP, intstr.FromInt32(53)),
+								networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(53)),
+							},
+						},
+					},
+				},
+			},
+		},
+		Prometheus: Resource[map[string]any]{
+			ID:       dr.Prometheus.ID,
+			HasValue: false,
+			Value: map[string]any{
+				"apiVersion": "monitoring.coreos.com/v1",
+				"kind":       "Prometheus",
+				"metadata": map[string]any{
+					"name":   fullName + "-prometheus",
+					"labels": cpLabelsAny(),
+				},
+				"spec": map[string]any{
+					"replicas":                  float64(1),
+					"retention":                 "30d",
+					"enableRemoteWriteReceiver": true,
+					"resources": map[string]any{
+						"requests": map[string]any{
+							"cpu":    "250m",
+							"memory": "1Gi",
+						},
+						"limits": map[string]any{
+							"memory": "2Gi",
+						},
+					},
+					"storage": map[string]any{
+						"volumeClaimTemplate": map[string]any{
+							"spec": map[string]any{
+								"accessModes": []any{"ReadWriteOnce"},
+								"resources": map[string]any{
+									"requests": map[string]any{
+										"storage": "10Gi",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		PrometheusService: Resource[corev1.Service]{
+			ID:       dr.PrometheusService.ID,
+			HasValue: false,
+			Value: corev1.Service{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Service",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-prometheus",
+					Labels: cpLabels(),
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: map[string]string{
+						"app.kubernetes.io/name": "prometheus",
+						"prometheus":             fullName + "-prometheus",
+					},
+					Ports: []corev1.ServicePort{
+						{
+							Name:       "web",
+							Port:       9090,
+							TargetPort: intstr.FromString("web"),
+						},
+					},
+				},
+			},
+		},
 		Service: Resource[corev1.Service]{
 			ID:       dr.Service.ID,
 			HasValue: true,
@@ -424,6 +649,182 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 				},
 			},
 		},
+		StatefulSet: Resource[appsv1.StatefulSet]{
+			ID:       dr.StatefulSet.ID,
+			HasValue: false,
+		},
+		BackupCronJob: Resource[batchv1.CronJob]{
+			ID:       dr.BackupCronJob.ID,
+			HasValue: false,
+			Value: batchv1.CronJob{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "CronJob",
+					APIVersion: "batch/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-backup",
+					Labels: cpLabels(),
+				},
+				Spec: batchv1.CronJobSpec{
+					Schedule:          "0 3 * * *",
+					ConcurrencyPolicy: batchv1.ForbidConcurrent,
+					JobTemplate: batchv1.JobTemplateSpec{
+						Spec: batchv1.JobSpec{
+							BackoffLimit: &backoffLimit2,
+							Template: corev1.PodTemplateSpec{
+								ObjectMeta: v1.ObjectMeta{
+									Labels: backupLabels(),
+								},
+								Spec: corev1.PodSpec{
+									RestartPolicy: corev1.RestartPolicyOnFailure,
+									ImagePullSecrets: []corev1.LocalObjectReference{
+										{
+											Name: fullName + "-regcred",
+										},
+									},
+									ServiceAccountName: fullName + "-backup",
+									SecurityContext: &corev1.PodSecurityContext{
+										RunAsUser:    &runAsUser1000,
+										RunAsNonRoot: &trueBool,
+									},
+									Containers: []corev1.Container{
+										{
+											Name:  "backup",
+											Image: "alpine/k8s:1.31.4",
+											Env: []corev1.EnvVar{
+												{Name: "HOME", Value: "/tmp"},
+												{Name: "PVCS", Value: fullName + "-encryption " + fullName + "-postgres " + fullName + "-prometheus"},
+												{Name: "RETENTION", Value: "7"},
+												{Name: "VOLUME_SNAPSHOT_CLASS", Value: ""},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		BackupRole: Resource[rbacv1.Role]{
+			ID:       dr.BackupRole.ID,
+			HasValue: false,
+			Value: rbacv1.Role{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Role",
+					APIVersion: "rbac.authorization.k8s.io/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-backup",
+					Labels: cpLabels(),
+				},
+				Rules: []rbacv1.PolicyRule{
+					{
+						APIGroups: []string{"snapshot.storage.k8s.io"},
+						Resources: []string{"volumesnapshots"},
+						Verbs:     []string{"get", "list", "create", "delete"},
+					},
+				},
+			},
+		},
+		BackupRoleBinding: Resource[rbacv1.RoleBinding]{
+			ID:       dr.BackupRoleBinding.ID,
+			HasValue: false,
+			Value: rbacv1.RoleBinding{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "RoleBinding",
+					APIVersion: "rbac.authorization.k8s.io/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-backup",
+					Labels: cpLabels(),
+				},
+				Subjects: []rbacv1.Subject{
+					{
+						Kind: "ServiceAccount",
+						Name: fullName + "-backup",
+					},
+				},
+				RoleRef: rbacv1.RoleRef{
+					Kind:     "Role",
+					Name:     fullName + "-backup",
+					APIGroup: "rbac.authorization.k8s.io",
+				},
+			},
+		},
+		BackupServiceAccount: Resource[corev1.ServiceAccount]{
+			ID:       dr.BackupServiceAccount.ID,
+			HasValue: false,
+			Value: corev1.ServiceAccount{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "ServiceAccount",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-backup",
+					Labels: cpLabels(),
+				},
+			},
+		},
+		// migration hooks are checked against the Deployment in TestMigration
+		MigrationConfigSecret: Resource[corev1.Secret]{
+			ID:       dr.MigrationConfigSecret.ID,
+			HasValue: false,
+		},
+		MigrationJob: Resource[batchv1.Job]{
+			ID:       dr.MigrationJob.ID,
+			HasValue: false,
+		},
+		MigrationScaleDownJob: Resource[batchv1.Job]{
+			ID:       dr.MigrationScaleDownJob.ID,
+			HasValue: false,
+		},
+		TestPod: Resource[corev1.Pod]{
+			ID:       dr.TestPod.ID,
+			HasValue: true,
+			Value: corev1.Pod{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Pod",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-test",
+					Labels: testLabels(),
+					Annotations: map[string]string{
+						"helm.sh/hook":               "test",
+						"helm.sh/hook-delete-policy": "before-hook-creation,hook-succeeded",
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					ImagePullSecrets: []corev1.LocalObjectReference{
+						{
+							Name: fullName + "-regcred",
+						},
+					},
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsUser:    &runAsUser1000,
+						RunAsNonRoot: &trueBool,
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "test",
+							Image:   "curlimages/curl:8.11.1",
+							Command: []string{"curl"},
+							Args: []string{
+								"-fsS",
+								"--retry",
+								"5",
+								"--retry-connrefused",
+								"--retry-delay",
+								"2",
+								"http://" + fullName + "." + test.Namespace + ".svc:80/healthz",
+							},
+						},
+					},
+				},
+			},
+		},
 		ExtraConfigMap: Resource[corev1.ConfigMap]{
 			ID:       dr.ExtraConfigMap.ID,
 			HasValue: false,
@@ -458,6 +859,26 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 	}
 }
 
+func networkPolicyPort(protocol corev1.Protocol, port intstr.IntOrString) networkingv1.NetworkPolicyPort {
+	return networkingv1.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &port,
+	}
+}
+
+// haResources are the default container resources when single replica mode is disabled
+func haResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("250m"),
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}
+}
+
 func TestDefaultValues(t *testing.T) {
 	t.Parallel()
 	test := DefaultTest()
@@ -4,7 +4,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	corev1 "k8s.io/api/core/v1"
@@ -33,11 +36,15 @@ imagePullSecret:
 		&expected.SingleReplicaModeEncryptionPvc.Value.ObjectMeta,
 		&expected.SingleReplicaModePostgresPvc.Value.ObjectMeta,
 		&expected.SingleReplicaModePrometheusPvc.Value.ObjectMeta,
+		&expected.TestPod.Value.ObjectMeta,
 	}
 	for _, m := range meta {
 		m.Labels["global"] = "global"
 	}
 
+	expected.TestPod.Value.Spec.Containers[0].Image = "docker.io/curlimages/curl:8.11.1"
+	expected.TestPod.Value.Spec.Containers[0].ImagePullPolicy = corev1.PullAlways
+
 	pts := &expected.Deployment.Value.Spec.Template.Spec
 	pts.ImagePullSecrets = nil
 
@@ -47,6 +54,7 @@ imagePullSecret:
 	ctr.ImagePullPolicy = corev1.PullAlways
 
 	expected.ImagePullSecret.HasValue = false
+	expected.TestPod.Value.Spec.ImagePullSecrets = nil
 
 	RenderAndCheck(t, test, expected)
 }
@@ -129,6 +137,638 @@ podTemplate:
 	RenderAndCheck(t, test, expected)
 }
 
+func TestSchedulingOptions(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+global:
+  podTemplate:
+    nodeSelector:
+      kubernetes.io/os: linux
+    tolerations:
+    - key: dedicated
+      operator: Equal
+      value: synadia
+      effect: NoSchedule
+    priorityClassName: global-priority
+podTemplate:
+  affinity:
+    nodeAffinity:
+      requiredDuringSchedulingIgnoredDuringExecution:
+        nodeSelectorTerms:
+        - matchExpressions:
+          - key: kubernetes.io/arch
+            operator: In
+            values:
+            - amd64
+  priorityClassName: high-priority
+  runtimeClassName: gvisor
+`
+
+	expected := DefaultResources(t, test)
+
+	pts := &expected.Deployment.Value.Spec.Template.Spec
+	pts.NodeSelector = map[string]string{
+		"kubernetes.io/os": "linux",
+	}
+	pts.Tolerations = []corev1.Toleration{
+		{
+			Key:      "dedicated",
+			Operator: corev1.TolerationOpEqual,
+			Value:    "synadia",
+			Effect:   corev1.TaintEffectNoSchedule,
+		},
+	}
+	pts.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{
+								Key:      "kubernetes.io/arch",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{"amd64"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	pts.PriorityClassName = "high-priority"
+	runtimeClassName := "gvisor"
+	pts.RuntimeClassName = &runtimeClassName
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestImageDigest(t *testing.T) {
+	t.Parallel()
+	digest := "sha256:" + strings.Repeat("0123456789abcdef", 4)
+	values := map[string]struct {
+		values string
+		image  string
+		// empty when imagePullSecret is disabled
+		pullSecretRegistry string
+		// helper images only use global.image.registry
+		testImage string
+	}{
+		"imagePullSecret registry": {`
+container:
+  image:
+    digest: ` + digest + `
+`, "registry.synadia.io/control-plane:1.9.3@" + digest, "registry.synadia.io", "curlimages/curl:8.11.1"},
+		"custom imagePullSecret registry": {`
+global:
+  image:
+    registry: docker.io
+imagePullSecret:
+  registry: mirror.example.com
+container:
+  image:
+    digest: ` + digest + `
+`, "mirror.example.com/control-plane:1.9.3@" + digest, "mirror.example.com", "docker.io/curlimages/curl:8.11.1"},
+		"global registry without tag": {`
+global:
+  image:
+    registry: docker.io
+imagePullSecret:
+  enabled: false
+container:
+  image:
+    tag: ""
+    digest: ` + digest + `
+`, "docker.io/control-plane@" + digest, "", "docker.io/curlimages/curl:8.11.1"},
+		"image registry": {`
+global:
+  image:
+    registry: docker.io
+container:
+  image:
+    registry: mirror.example.com
+    digest: ` + digest + `
+`, "mirror.example.com/control-plane:1.9.3@" + digest, "registry.synadia.io", "docker.io/curlimages/curl:8.11.1"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values
+			expected := DefaultResources(t, test)
+			expected.Deployment.Value.Spec.Template.Spec.Containers[0].Image = value.image
+			expected.TestPod.Value.Spec.Containers[0].Image = value.testImage
+			if value.pullSecretRegistry == "" {
+				expected.Deployment.Value.Spec.Template.Spec.ImagePullSecrets = nil
+				expected.ImagePullSecret.HasValue = false
+				expected.TestPod.Value.Spec.ImagePullSecrets = nil
+			} else {
+				expected.ImagePullSecret.Value.StringData[corev1.DockerConfigJsonKey] = `{"auths":{"` + value.pullSecretRegistry + `":{}}}
+`
+			}
+			RenderAndCheck(t, test, expected)
+		})
+	}
+}
+
+func TestImagePullSecrets(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values    string
+		secrets   []string
+		generated bool
+		// defaults to the test image without a registry
+		testImage string
+	}{
+		"generated": {``, []string{"control-plane-regcred"}, true, ""},
+		"existing names": {`
+global:
+  image:
+    pullSecretNames:
+    - mirror-a
+    - mirror-b
+    registry: registry.synadia.io
+imagePullSecret:
+  enabled: false
+`, []string{"mirror-a", "mirror-b"}, false, "registry.synadia.io/curlimages/curl:8.11.1"},
+		"both": {`
+global:
+  image:
+    pullSecretNames:
+    - mirror-a
+    - control-plane-regcred
+`, []string{"control-plane-regcred", "mirror-a"}, true, ""},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values
+			expected := DefaultResources(t, test)
+
+			var secrets []corev1.LocalObjectReference
+			for _, s := range value.secrets {
+				secrets = append(secrets, corev1.LocalObjectReference{Name: s})
+			}
+			expected.Deployment.Value.Spec.Template.Spec.ImagePullSecrets = secrets
+			expected.TestPod.Value.Spec.ImagePullSecrets = secrets
+			expected.ImagePullSecret.HasValue = value.generated
+			if value.testImage != "" {
+				expected.TestPod.Value.Spec.Containers[0].Image = value.testImage
+			}
+
+			RenderAndCheck(t, test, expected)
+		})
+	}
+}
+
+func TestImageDigestInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"short digest": {`container:
+  image:
+    digest: sha256:0123
+`, "control-plane image digest sha256:0123 must match sha256:[a-f0-9]{64}"},
+		"upper case digest": {`container:
+  image:
+    digest: sha256:` + strings.Repeat("0123456789ABCDEF", 4) + `
+`, "must match sha256:[a-f0-9]{64}"},
+		"tag as digest": {`test:
+  image:
+    digest: "1.9.3"
+`, "curlimages/curl image digest 1.9.3 must match sha256:[a-f0-9]{64}"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestContainerResources(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+container:
+  resources:
+    requests:
+      cpu: "1"
+      memory: 2Gi
+    limits:
+      memory: 8Gi
+  goMemLimit:
+    enabled: true
+    percent: 75
+`
+	expected := DefaultResources(t, test)
+
+	ctr := &expected.Deployment.Value.Spec.Template.Spec.Containers[0]
+	ctr.Resources = corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("2Gi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("8Gi"),
+		},
+	}
+	ctr.Env = []corev1.EnvVar{
+		{
+			Name:  "GOMEMLIMIT",
+			Value: "6442450944",
+		},
+	}
+
+	RenderAndCheck(t, test, expected)
+
+	// env takes precedence over goMemLimit
+	test.Values += `
+  env:
+    GOMEMLIMIT: 4GiB
+`
+	ctr.Env[0].Value = "4GiB"
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestContainerResourcesEmpty(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+container:
+  resources: {}
+`
+	expected := DefaultResources(t, test)
+	expected.Deployment.Value.Spec.Template.Spec.Containers[0].Resources = corev1.ResourceRequirements{}
+
+	RenderAndCheck(t, test, expected)
+
+	// null uses the defaults
+	test.Values = `
+container:
+  resources: null
+`
+	RenderAndCheck(t, test, DefaultResources(t, test))
+}
+
+func TestContainerResourcesInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"no memory limit": {`container:
+  resources:
+    requests:
+      memory: 1Gi
+  goMemLimit:
+    enabled: true
+`, "container.resources.limits.memory is required when container.goMemLimit is enabled"},
+		"decimal memory limit": {`container:
+  resources:
+    limits:
+      memory: 1.5Gi
+  goMemLimit:
+    enabled: true
+`, "container.resources.limits.memory 1.5Gi can not be used for container.goMemLimit"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestDeploymentRollout(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+deployment:
+  minReadySeconds: 10
+  revisionHistoryLimit: 0
+  progressDeadlineSeconds: 300
+`
+	expected := DefaultResources(t, test)
+
+	dep := &expected.Deployment.Value.Spec
+	dep.MinReadySeconds = 10
+	zero := int32(0)
+	dep.RevisionHistoryLimit = &zero
+	deadline := int32(300)
+	dep.ProgressDeadlineSeconds = &deadline
+
+	RenderAndCheck(t, test, expected)
+
+	// RollingUpdate is allowed in singleReplicaMode when no PVCs are mounted
+	test.Values += `
+  strategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 1
+      maxUnavailable: 0
+singleReplicaMode:
+  encryptionPvc:
+    enabled: false
+  postgresPvc:
+    enabled: false
+  prometheusPvc:
+    enabled: false
+`
+	expected = DefaultResources(t, test)
+
+	dep = &expected.Deployment.Value.Spec
+	dep.MinReadySeconds = 10
+	dep.RevisionHistoryLimit = &zero
+	dep.ProgressDeadlineSeconds = &deadline
+	maxSurge := intstr.FromInt32(1)
+	maxUnavailable := intstr.FromInt32(0)
+	dep.Strategy = appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       &maxSurge,
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+
+	pts := &dep.Template.Spec
+	pts.Volumes = append(pts.Volumes[:2], pts.Volumes[5:]...)
+	ctr := &pts.Containers[0]
+	ctr.VolumeMounts = append(ctr.VolumeMounts[:2], ctr.VolumeMounts[5:]...)
+
+	expected.SingleReplicaModeEncryptionPvc.HasValue = false
+	expected.SingleReplicaModePostgresPvc.HasValue = false
+	expected.SingleReplicaModePrometheusPvc.HasValue = false
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestDeploymentRolloutReadWriteMany(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+deployment:
+  strategy:
+    type: RollingUpdate
+singleReplicaMode:
+  encryptionPvc:
+    accessModes:
+    - ReadWriteMany
+  postgresPvc:
+    accessModes:
+    - ReadWriteMany
+  prometheusPvc:
+    accessModes:
+    - ReadWriteMany
+`
+	// ReadWriteMany volumes can be attached to the old and new pods during a rolling update
+	actual := HelmRender(t, test)
+	require.True(t, actual.Deployment.HasValue)
+	require.Equal(t, appsv1.RollingUpdateDeploymentStrategyType, actual.Deployment.Value.Spec.Strategy.Type)
+	for _, pvc := range []Resource[corev1.PersistentVolumeClaim]{
+		actual.SingleReplicaModeEncryptionPvc,
+		actual.SingleReplicaModePostgresPvc,
+		actual.SingleReplicaModePrometheusPvc,
+	} {
+		require.True(t, pvc.HasValue)
+		require.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}, pvc.Value.Spec.AccessModes)
+	}
+}
+
+func TestDeploymentRolloutInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"rolling update with pvcs": {`
+deployment:
+  strategy:
+    type: RollingUpdate
+`, "deployment.strategy.type must be Recreate when singleReplicaMode PVCs use ReadWriteOnce or ReadWriteOncePod"},
+		"implicit rolling update with pvcs": {`
+deployment:
+  strategy:
+    rollingUpdate:
+      maxSurge: 1
+`, "deployment.strategy.type must be Recreate when singleReplicaMode PVCs use ReadWriteOnce or ReadWriteOncePod"},
+		"rolling update with read write once pod": {`
+deployment:
+  strategy:
+    type: RollingUpdate
+singleReplicaMode:
+  encryptionPvc:
+    enabled: false
+  postgresPvc:
+    accessModes:
+    - ReadWriteMany
+  prometheusPvc:
+    accessModes:
+    - ReadWriteOncePod
+`, "deployment.strategy.type must be Recreate when singleReplicaMode PVCs use ReadWriteOnce or ReadWriteOncePod"},
+		"unknown strategy": {`
+deployment:
+  strategy:
+    type: BlueGreen
+`, "deployment.strategy.type must be Recreate or RollingUpdate, got BlueGreen"},
+		"recreate with rolling update": {`
+deployment:
+  strategy:
+    type: Recreate
+    rollingUpdate:
+      maxSurge: 1
+`, "deployment.strategy.rollingUpdate must not be set when deployment.strategy.type is Recreate"},
+		"zero surge and unavailable": {`
+deployment:
+  strategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 0
+      maxUnavailable: 0%
+`, "deployment.strategy.rollingUpdate.maxSurge and maxUnavailable must not both be 0"},
+		"negative revision history": {`
+deployment:
+  revisionHistoryLimit: -1
+`, "deployment.revisionHistoryLimit must not be negative"},
+		"progress deadline before min ready": {`
+deployment:
+  minReadySeconds: 60
+  progressDeadlineSeconds: 60
+`, "deployment.progressDeadlineSeconds must be greater than deployment.minReadySeconds"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestContainerProbes(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+container:
+  probes:
+    startup:
+      failureThreshold: 60
+    liveness:
+      httpGet: null
+      tcpSocket:
+        port: http
+    readiness:
+      enabled: false
+`
+	expected := DefaultResources(t, test)
+
+	ctr := &expected.Deployment.Value.Spec.Template.Spec.Containers[0]
+	ctr.StartupProbe.FailureThreshold = 60
+	ctr.LivenessProbe.ProbeHandler = corev1.ProbeHandler{
+		TCPSocket: &corev1.TCPSocketAction{
+			Port: intstr.FromString("http"),
+		},
+	}
+	ctr.ReadinessProbe = nil
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestPodTemplateExtras(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+config:
+  kms:
+    key:
+      url: file:///etc/kms/key
+podTemplate:
+  extraVolumes:
+  - name: kms
+    secret:
+      secretName: kms
+  initContainers:
+  - name: wait-for-postgres
+    image: busybox
+    args:
+    - $tplYaml: >
+        {{ .Release.Name }}-postgres
+  sidecars:
+  - name: ca-bundle
+    image: busybox
+container:
+  extraVolumeMounts:
+  - name: kms
+    mountPath: /etc/kms
+`
+	expected := DefaultResources(t, test)
+	expected.Conf.Value["kms"] = map[string]any{
+		"key_url": "file:///etc/kms/key",
+	}
+
+	pts := &expected.Deployment.Value.Spec.Template.Spec
+	pts.Volumes = append(pts.Volumes, corev1.Volume{
+		Name: "kms",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: "kms",
+			},
+		},
+	})
+	pts.InitContainers = []corev1.Container{
+		{
+			Name:  "wait-for-postgres",
+			Image: "busybox",
+			Args:  []string{test.ReleaseName + "-postgres"},
+		},
+	}
+	pts.Containers = append(pts.Containers, corev1.Container{
+		Name:  "ca-bundle",
+		Image: "busybox",
+	})
+
+	ctr := &pts.Containers[0]
+	ctr.VolumeMounts = append(ctr.VolumeMounts, corev1.VolumeMount{
+		Name:      "kms",
+		MountPath: "/etc/kms",
+	})
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestPodTemplateExtrasInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"volume collides with chart volume": {`podTemplate:
+  extraVolumes:
+  - name: data
+    emptyDir: {}
+`, "podTemplate.extraVolumes name data collides with an existing name"},
+		"volume collides with secret volume": {`config:
+  kms:
+    key:
+      secretName: kms
+podTemplate:
+  extraVolumes:
+  - name: kms-key
+    emptyDir: {}
+`, "podTemplate.extraVolumes name kms-key collides with an existing name"},
+		"duplicate volumes": {`podTemplate:
+  extraVolumes:
+  - name: extra
+    emptyDir: {}
+  - name: extra
+    emptyDir: {}
+`, "podTemplate.extraVolumes name extra collides with an existing name"},
+		"sidecar collides with container": {`podTemplate:
+  sidecars:
+  - name: syn-cp
+    image: busybox
+`, "podTemplate.sidecars name syn-cp collides with an existing name"},
+		"sidecar collides with config init container": {`podTemplate:
+  sidecars:
+  - name: config-init
+    image: busybox
+`, "podTemplate.sidecars name config-init collides with an existing name"},
+		"init container collides with sidecar": {`podTemplate:
+  sidecars:
+  - name: ca-bundle
+    image: busybox
+  initContainers:
+  - name: ca-bundle
+    image: busybox
+`, "podTemplate.initContainers name ca-bundle collides with an existing name"},
+		"volume without name": {`podTemplate:
+  extraVolumes:
+  - emptyDir: {}
+`, "podTemplate.extraVolumes entries require a name"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
 func TestResourcesMergePatch(t *testing.T) {
 	t.Parallel()
 	values := map[string]string{
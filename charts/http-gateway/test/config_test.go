@@ -0,0 +1,163 @@
+package test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestHelmTestTls(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+  tls:
+    enabled: true
+    cert:
+      enabled: true
+      secretName: http-gateway-tls
+service:
+  ports:
+    https:
+      enabled: true
+`
+	actual := HelmRender(t, test)
+	require.True(t, actual.TestPod.HasValue)
+	require.Equal(t, []string{
+		"-fsS",
+		"-k",
+		"--retry",
+		"5",
+		"--retry-connrefused",
+		"--retry-delay",
+		"2",
+		"https://http-gateway.http-gateway.svc:443/healthz",
+	}, actual.TestPod.Value.Spec.Containers[0].Args)
+}
+
+func TestHelmTestInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"tls without https port": {`
+  tls:
+    enabled: true
+    cert:
+      enabled: true
+      secretName: http-gateway-tls
+`, "service.ports.https must be enabled for the test pod"},
+		"no http port": {`
+service:
+  ports:
+    http:
+      enabled: false
+`, "service.ports.http must be enabled for the test pod"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		values         string
+		ingressPorts   []string
+		containerPorts []corev1.ContainerPort
+	}{
+		"http": {
+			values: `  httpPort: 8080
+networkPolicy:
+  enabled: true
+`,
+			ingressPorts: []string{"http"},
+			containerPorts: []corev1.ContainerPort{
+				{Name: "http", ContainerPort: 8080},
+			},
+		},
+		"http and https": {
+			values: `  httpPort: 8080
+  httpsPort: 8443
+  tls:
+    enabled: true
+    cert:
+      enabled: true
+      secretName: http-gateway-tls
+service:
+  ports:
+    https:
+      enabled: true
+networkPolicy:
+  enabled: true
+`,
+			ingressPorts: []string{"http", "https"},
+			containerPorts: []corev1.ContainerPort{
+				{Name: "http", ContainerPort: 8080},
+				{Name: "https", ContainerPort: 8443},
+			},
+		},
+		"https only": {
+			values: `  tls:
+    enabled: true
+    cert:
+      enabled: true
+      secretName: http-gateway-tls
+service:
+  ports:
+    http:
+      enabled: false
+    https:
+      enabled: true
+networkPolicy:
+  enabled: true
+`,
+			ingressPorts: []string{"https"},
+			containerPorts: []corev1.ContainerPort{
+				{Name: "http", ContainerPort: 80},
+				{Name: "https", ContainerPort: 443},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			test := DefaultTest()
+			test.Values += tt.values
+			actual := HelmRender(t, test)
+			require.True(t, actual.NetworkPolicy.HasValue)
+			np := actual.NetworkPolicy.Value.Spec
+
+			container := actual.Deployment.Value.Spec.Template.Spec.Containers[0]
+			require.Equal(t, tt.containerPorts, container.Ports)
+
+			// every ingress port must be a container port, by name or number
+			require.Len(t, np.Ingress, 1)
+			var ingressPorts []string
+			for _, p := range np.Ingress[0].Ports {
+				ingressPorts = append(ingressPorts, p.Port.String())
+				require.True(t, slices.ContainsFunc(container.Ports, func(cp corev1.ContainerPort) bool {
+					return cp.Name == p.Port.String() || cp.ContainerPort == p.Port.IntVal
+				}), "ingress port %s is not a container port", p.Port.String())
+			}
+			require.Equal(t, tt.ingressPorts, ingressPorts)
+
+			require.Len(t, np.Egress, 2)
+			require.Equal(t, intstr.FromInt32(53), *np.Egress[0].Ports[0].Port)
+			require.Equal(t, []networkingv1.NetworkPolicyPort{
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(4222)),
+			}, np.Egress[1].Ports)
+		})
+	}
+}
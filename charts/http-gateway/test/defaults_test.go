@@ -0,0 +1,390 @@
+package test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type DynamicDefaults struct {
+	VersionLabel     string
+	HelmChartLabel   string
+	HttpGatewayImage string
+}
+
+type DynamicDefaultsGetter struct {
+	mu  sync.Mutex
+	set bool
+	dd  DynamicDefaults
+}
+
+var ddg DynamicDefaultsGetter
+
+func (d *DynamicDefaultsGetter) Get(t *testing.T) DynamicDefaults {
+	t.Helper()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.set {
+		return d.dd
+	}
+
+	test := DefaultTest()
+	r := HelmRender(t, test)
+
+	require.True(t, r.Deployment.HasValue)
+
+	var ok bool
+	d.dd.VersionLabel, ok = r.Deployment.Value.Labels["app.kubernetes.io/version"]
+	require.True(t, ok)
+	d.dd.HelmChartLabel, ok = r.Deployment.Value.Labels["helm.sh/chart"]
+	require.True(t, ok)
+
+	containers := r.Deployment.Value.Spec.Template.Spec.Containers
+	require.Len(t, containers, 1)
+	d.dd.HttpGatewayImage = containers[0].Image
+
+	return d.dd
+}
+
+func DefaultResources(t *testing.T, test *Test) *Resources {
+	fullName := test.FullName
+	chartName := test.ChartName
+	releaseName := test.ReleaseName
+
+	dd := ddg.Get(t)
+	dr := GenerateResources(fullName)
+
+	nhgLabels := func() map[string]string {
+		return map[string]string{
+			"app.kubernetes.io/component":  "http-gateway",
+			"app.kubernetes.io/instance":   releaseName,
+			"app.kubernetes.io/managed-by": "Helm",
+			"app.kubernetes.io/name":       chartName,
+			"app.kubernetes.io/version":    dd.VersionLabel,
+			"helm.sh/chart":                dd.HelmChartLabel,
+		}
+	}
+	nhgSelectorLabels := func() map[string]string {
+		return map[string]string{
+			"app.kubernetes.io/component": "http-gateway",
+			"app.kubernetes.io/instance":  releaseName,
+			"app.kubernetes.io/name":      chartName,
+		}
+	}
+	testLabels := func() map[string]string {
+		labels := nhgLabels()
+		labels["app.kubernetes.io/component"] = "http-gateway-test"
+		return labels
+	}
+	healthProbe := func() corev1.ProbeHandler {
+		return corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:   "/healthz",
+				Port:   intstr.FromString("http"),
+				Scheme: corev1.URISchemeHTTP,
+			},
+		}
+	}
+
+	replicas1 := int32(1)
+	replicas2 := int32(2)
+	trueBool := true
+	falseBool := false
+	testRunAsUser := int64(1000)
+	cpuUtilization := int32(80)
+	maxUnavailable := intstr.FromInt32(1)
+
+	return &Resources{
+		Deployment: Resource[appsv1.Deployment]{
+			ID:       dr.Deployment.ID,
+			HasValue: true,
+			Value: appsv1.Deployment{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Deployment",
+					APIVersion: "apps/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: nhgLabels(),
+				},
+				Spec: appsv1.DeploymentSpec{
+					Replicas: &replicas1,
+					Selector: &v1.LabelSelector{
+						MatchLabels: nhgSelectorLabels(),
+					},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: v1.ObjectMeta{
+							Labels: nhgLabels(),
+						},
+						Spec: corev1.PodSpec{
+							SecurityContext: &corev1.PodSecurityContext{
+								SeccompProfile: &corev1.SeccompProfile{
+									Type: corev1.SeccompProfileTypeRuntimeDefault,
+								},
+							},
+							Containers: []corev1.Container{
+								{
+									Image: dd.HttpGatewayImage,
+									Name:  "http-gateway",
+									SecurityContext: &corev1.SecurityContext{
+										AllowPrivilegeEscalation: &falseBool,
+										Capabilities: &corev1.Capabilities{
+											Drop: []corev1.Capability{"ALL"},
+										},
+									},
+									Args: []string{
+										"run",
+										"--tokens-bucket=NHG_TOKENS",
+										"--provider-creds=/etc/http-gateway/creds/nats.creds",
+										"--user-port=80",
+										"nats://connect.ngs.global",
+									},
+									Ports: []corev1.ContainerPort{
+										{
+											Name:          "http",
+											ContainerPort: 80,
+										},
+									},
+									LivenessProbe: &corev1.Probe{
+										ProbeHandler:     healthProbe(),
+										PeriodSeconds:    10,
+										FailureThreshold: 3,
+									},
+									ReadinessProbe: &corev1.Probe{
+										ProbeHandler:     healthProbe(),
+										PeriodSeconds:    10,
+										FailureThreshold: 3,
+									},
+									StartupProbe: &corev1.Probe{
+										ProbeHandler:        healthProbe(),
+										InitialDelaySeconds: 5,
+										PeriodSeconds:       3,
+										FailureThreshold:    20,
+									},
+									Resources: corev1.ResourceRequirements{
+										Requests: corev1.ResourceList{
+											corev1.ResourceCPU:    resource.MustParse("100m"),
+											corev1.ResourceMemory: resource.MustParse("128Mi"),
+										},
+										Limits: corev1.ResourceList{
+											corev1.ResourceMemory: resource.MustParse("512Mi"),
+										},
+									},
+									VolumeMounts: []corev1.VolumeMount{
+										{
+											Name:      "creds",
+											MountPath: "/etc/http-gateway/creds",
+										},
+									},
+								},
+							},
+							EnableServiceLinks: &falseBool,
+							ServiceAccountName: fullName,
+							Volumes: []corev1.Volume{
+								{
+									Name: "creds",
+									VolumeSource: corev1.VolumeSource{
+										Secret: &corev1.SecretVolumeSource{
+											SecretName: "http-gateway-creds",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		HPA: Resource[autoscalingv2.HorizontalPodAutoscaler]{
+			ID:       dr.HPA.ID,
+			HasValue: false,
+			Value: autoscalingv2.HorizontalPodAutoscaler{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "HorizontalPodAutoscaler",
+					APIVersion: "autoscaling/v2",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: nhgLabels(),
+				},
+				Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+					ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+						APIVersion: "apps/v1",
+						Kind:       "Deployment",
+						Name:       fullName,
+					},
+					MinReplicas: &replicas2,
+					MaxReplicas: 10,
+					Metrics: []autoscalingv2.MetricSpec{
+						{
+							Type: autoscalingv2.ResourceMetricSourceType,
+							Resource: &autoscalingv2.ResourceMetricSource{
+								Name: corev1.ResourceCPU,
+								Target: autoscalingv2.MetricTarget{
+									Type:               autoscalingv2.UtilizationMetricType,
+									AverageUtilization: &cpuUtilization,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		ImagePullSecret: Resource[corev1.Secret]{
+			ID:       dr.ImagePullSecret.ID,
+			HasValue: false,
+			Value: corev1.Secret{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Secret",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-regcred",
+					Labels: nhgLabels(),
+				},
+				Type: corev1.SecretTypeDockerConfigJson,
+				StringData: map[string]string{
+					corev1.DockerConfigJsonKey: `{"auths":{"registry.synadia.io":{}}}
+`,
+				},
+			},
+		},
+		NetworkPolicy: Resource[networkingv1.NetworkPolicy]{
+			ID:       dr.NetworkPolicy.ID,
+			HasValue: false,
+			Value: networkingv1.NetworkPolicy{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "NetworkPolicy",
+					APIVersion: "networking.k8s.io/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: nhgLabels(),
+				},
+			},
+		},
+		PodDisruptionBudget: Resource[policyv1.PodDisruptionBudget]{
+			ID:       dr.PodDisruptionBudget.ID,
+			HasValue: true,
+			Value: policyv1.PodDisruptionBudget{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "PodDisruptionBudget",
+					APIVersion: "policy/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: nhgLabels(),
+				},
+				Spec: policyv1.PodDisruptionBudgetSpec{
+					MaxUnavailable: &maxUnavailable,
+					Selector: &v1.LabelSelector{
+						MatchLabels: nhgSelectorLabels(),
+					},
+				},
+			},
+		},
+		Service: Resource[corev1.Service]{
+			ID:       dr.Service.ID,
+			HasValue: true,
+			Value: corev1.Service{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Service",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: nhgLabels(),
+				},
+				Spec: corev1.ServiceSpec{
+					Selector: nhgSelectorLabels(),
+					Ports: []corev1.ServicePort{
+						{
+							Name:       "http",
+							Port:       80,
+							TargetPort: intstr.FromString("http"),
+						},
+					},
+				},
+			},
+		},
+		ServiceAccount: Resource[corev1.ServiceAccount]{
+			ID:       dr.ServiceAccount.ID,
+			HasValue: true,
+			Value: corev1.ServiceAccount{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "ServiceAccount",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: nhgLabels(),
+				},
+			},
+		},
+		TestPod: Resource[corev1.Pod]{
+			ID:       dr.TestPod.ID,
+			HasValue: true,
+			Value: corev1.Pod{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Pod",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-test",
+					Labels: testLabels(),
+					Annotations: map[string]string{
+						"helm.sh/hook":               "test",
+						"helm.sh/hook-delete-policy": "before-hook-creation,hook-succeeded",
+					},
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot: &trueBool,
+						RunAsUser:    &testRunAsUser,
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "test",
+							Image:   "docker.io/curlimages/curl:8.11.1",
+							Command: []string{"curl"},
+							Args: []string{
+								"-fsS",
+								"--retry",
+								"5",
+								"--retry-connrefused",
+								"--retry-delay",
+								"2",
+								"http://" + fullName + "." + test.Namespace + ".svc:80/healthz",
+							},
+						},
+					},
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+}
+
+func networkPolicyPort(protocol corev1.Protocol, port intstr.IntOrString) networkingv1.NetworkPolicyPort {
+	return networkingv1.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &port,
+	}
+}
+
+func TestDefaultValues(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	expected := DefaultResources(t, test)
+	RenderAndCheck(t, test, expected)
+}
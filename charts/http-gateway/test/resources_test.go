@@ -0,0 +1,528 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestAutoscaling(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+autoscaling:
+  enabled: true
+  minReplicas: 3
+  maxReplicas: 6
+  targetMemoryUtilizationPercentage: 70
+  metrics:
+  - type: Pods
+    pods:
+      metric:
+        name: http_requests
+      target:
+        type: AverageValue
+        averageValue: "100"
+deployment:
+  replicas: 5
+`
+	expected := DefaultResources(t, test)
+	expected.Deployment.Value.Spec.Replicas = nil
+
+	three := int32(3)
+	memoryUtilization := int32(70)
+	averageValue := resource.MustParse("100")
+	expected.HPA.HasValue = true
+	hpa := &expected.HPA.Value.Spec
+	hpa.MinReplicas = &three
+	hpa.MaxReplicas = 6
+	hpa.Metrics = append(hpa.Metrics,
+		autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: corev1.ResourceMemory,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &memoryUtilization,
+				},
+			},
+		},
+		autoscalingv2.MetricSpec{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{
+				Metric: autoscalingv2.MetricIdentifier{
+					Name: "http_requests",
+				},
+				Target: autoscalingv2.MetricTarget{
+					Type:         autoscalingv2.AverageValueMetricType,
+					AverageValue: &averageValue,
+				},
+			},
+		},
+	)
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestAutoscalingInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"min greater than max": {`
+autoscaling:
+  enabled: true
+  minReplicas: 5
+  maxReplicas: 3
+`, "autoscaling.minReplicas must not be greater than autoscaling.maxReplicas"},
+		"no metrics": {`
+autoscaling:
+  enabled: true
+  targetCPUUtilizationPercentage: null
+`, "autoscaling requires targetCPUUtilizationPercentage, targetMemoryUtilizationPercentage or metrics"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestImagePullSecrets(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values    string
+		secrets   []string
+		generated bool
+	}{
+		"generated": {`
+imagePullSecret:
+  enabled: true
+`, []string{"http-gateway-regcred"}, true},
+		"existing names": {`
+global:
+  image:
+    pullSecretNames:
+    - mirror-a
+    - mirror-b
+`, []string{"mirror-a", "mirror-b"}, false},
+		"both": {`
+global:
+  image:
+    pullSecretNames:
+    - mirror-a
+    - http-gateway-regcred
+imagePullSecret:
+  enabled: true
+`, []string{"http-gateway-regcred", "mirror-a"}, true},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			expected := DefaultResources(t, test)
+
+			var secrets []corev1.LocalObjectReference
+			for _, s := range value.secrets {
+				secrets = append(secrets, corev1.LocalObjectReference{Name: s})
+			}
+			expected.Deployment.Value.Spec.Template.Spec.ImagePullSecrets = secrets
+			expected.TestPod.Value.Spec.ImagePullSecrets = secrets
+			expected.ImagePullSecret.HasValue = value.generated
+
+			RenderAndCheck(t, test, expected)
+		})
+	}
+}
+
+func TestSchedulingOptions(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+global:
+  podTemplate:
+    nodeSelector:
+      kubernetes.io/os: linux
+    tolerations:
+    - key: dedicated
+      operator: Equal
+      value: synadia
+      effect: NoSchedule
+    priorityClassName: global-priority
+podTemplate:
+  affinity:
+    nodeAffinity:
+      requiredDuringSchedulingIgnoredDuringExecution:
+        nodeSelectorTerms:
+        - matchExpressions:
+          - key: kubernetes.io/arch
+            operator: In
+            values:
+            - amd64
+  priorityClassName: high-priority
+  runtimeClassName: gvisor
+`
+
+	expected := DefaultResources(t, test)
+
+	pts := &expected.Deployment.Value.Spec.Template.Spec
+	pts.NodeSelector = map[string]string{
+		"kubernetes.io/os": "linux",
+	}
+	pts.Tolerations = []corev1.Toleration{
+		{
+			Key:      "dedicated",
+			Operator: corev1.TolerationOpEqual,
+			Value:    "synadia",
+			Effect:   corev1.TaintEffectNoSchedule,
+		},
+	}
+	pts.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{
+								Key:      "kubernetes.io/arch",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{"amd64"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	pts.PriorityClassName = "high-priority"
+	runtimeClassName := "gvisor"
+	pts.RuntimeClassName = &runtimeClassName
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestContainerResources(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+container:
+  resources:
+    requests:
+      cpu: 250m
+      memory: 256Mi
+    limits:
+      memory: 1Gi
+  goMemLimit:
+    enabled: true
+    percent: 75
+`
+	expected := DefaultResources(t, test)
+
+	ctr := &expected.Deployment.Value.Spec.Template.Spec.Containers[0]
+	ctr.Resources = corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("250m"),
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}
+	ctr.Env = append([]corev1.EnvVar{
+		{
+			Name:  "GOMEMLIMIT",
+			Value: "805306368",
+		},
+	}, ctr.Env...)
+
+	RenderAndCheck(t, test, expected)
+
+	// env takes precedence over goMemLimit
+	test.Values += `  env:
+    GOMEMLIMIT: 512MiB
+`
+	ctr.Env[0].Value = "512MiB"
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestContainerResourcesEmpty(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+container:
+  resources: {}
+`
+	expected := DefaultResources(t, test)
+	expected.Deployment.Value.Spec.Template.Spec.Containers[0].Resources = corev1.ResourceRequirements{}
+
+	RenderAndCheck(t, test, expected)
+
+	// null uses the defaults
+	test = DefaultTest()
+	test.Values += `
+container:
+  resources: null
+`
+	RenderAndCheck(t, test, DefaultResources(t, test))
+}
+
+func TestContainerResourcesInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"no memory limit": {`
+container:
+  resources:
+    requests:
+      memory: 128Mi
+  goMemLimit:
+    enabled: true
+`, "container.resources.limits.memory is required when container.goMemLimit is enabled"},
+		"decimal memory limit": {`
+container:
+  resources:
+    limits:
+      memory: 1.5Gi
+  goMemLimit:
+    enabled: true
+`, "container.resources.limits.memory 1.5Gi can not be used for container.goMemLimit"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestPodTemplateExtras(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+podTemplate:
+  extraVolumes:
+  - name: ca-bundle
+    emptyDir: {}
+  initContainers:
+  - name: wait-for-nats
+    image: busybox
+    args:
+    - $tplYaml: >
+        {{ .Release.Name }}-nats
+  sidecars:
+  - name: ca-bundle
+    image: busybox
+container:
+  extraVolumeMounts:
+  - name: ca-bundle
+    mountPath: /etc/ca-bundle
+`
+	expected := DefaultResources(t, test)
+
+	pts := &expected.Deployment.Value.Spec.Template.Spec
+	pts.Volumes = append(pts.Volumes, corev1.Volume{
+		Name: "ca-bundle",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+	pts.InitContainers = []corev1.Container{
+		{
+			Name:  "wait-for-nats",
+			Image: "busybox",
+			Args:  []string{test.ReleaseName + "-nats"},
+		},
+	}
+	pts.Containers = append(pts.Containers, corev1.Container{
+		Name:  "ca-bundle",
+		Image: "busybox",
+	})
+
+	ctr := &pts.Containers[0]
+	ctr.VolumeMounts = append(ctr.VolumeMounts, corev1.VolumeMount{
+		Name:      "ca-bundle",
+		MountPath: "/etc/ca-bundle",
+	})
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestPodTemplateExtrasInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"volume collides with chart volume": {`
+podTemplate:
+  extraVolumes:
+  - name: creds
+    emptyDir: {}
+`, "podTemplate.extraVolumes name creds collides with an existing name"},
+		"duplicate volumes": {`
+podTemplate:
+  extraVolumes:
+  - name: extra
+    emptyDir: {}
+  - name: extra
+    emptyDir: {}
+`, "podTemplate.extraVolumes name extra collides with an existing name"},
+		"sidecar collides with container": {`
+podTemplate:
+  sidecars:
+  - name: http-gateway
+    image: busybox
+`, "podTemplate.sidecars name http-gateway collides with an existing name"},
+		"init container collides with sidecar": {`
+podTemplate:
+  sidecars:
+  - name: ca-bundle
+    image: busybox
+  initContainers:
+  - name: ca-bundle
+    image: busybox
+`, "podTemplate.initContainers name ca-bundle collides with an existing name"},
+		"volume without name": {`
+podTemplate:
+  extraVolumes:
+  - emptyDir: {}
+`, "podTemplate.extraVolumes entries require a name"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	t.Parallel()
+	digest := "sha256:" + strings.Repeat("0123456789abcdef", 4)
+	values := map[string]struct {
+		values string
+		image  string
+	}{
+		"default registry": {`
+container:
+  image:
+    digest: ` + digest + `
+`, "registry.synadia.io/http-gateway:0.1.21@" + digest},
+		"global registry without tag": {`
+global:
+  image:
+    registry: docker.io
+container:
+  image:
+    tag: ""
+    digest: ` + digest + `
+`, "docker.io/http-gateway@" + digest},
+		"image registry": {`
+global:
+  image:
+    registry: docker.io
+container:
+  image:
+    registry: mirror.example.com
+    digest: ` + digest + `
+`, "mirror.example.com/http-gateway:0.1.21@" + digest},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			expected := DefaultResources(t, test)
+			expected.Deployment.Value.Spec.Template.Spec.Containers[0].Image = value.image
+			RenderAndCheck(t, test, expected)
+		})
+	}
+
+	// the generated pull secret defaults to the same registry as the image
+	test := DefaultTest()
+	test.Values += `
+global:
+  image:
+    registry: mirror.example.com
+imagePullSecret:
+  enabled: true
+container:
+  image:
+    digest: ` + digest + `
+`
+	actual := HelmRender(t, test)
+	require.Equal(t, "mirror.example.com/http-gateway:0.1.21@"+digest, actual.Deployment.Value.Spec.Template.Spec.Containers[0].Image)
+	require.Equal(t, `{"auths":{"mirror.example.com":{}}}
+`, actual.ImagePullSecret.Value.StringData[corev1.DockerConfigJsonKey])
+
+	// imagePullSecret.registry does not change the image registry
+	test = DefaultTest()
+	test.Values += `
+global:
+  image:
+    registry: mirror.example.com
+imagePullSecret:
+  enabled: true
+  registry: other.example.com
+container:
+  image:
+    registry: docker.io
+    digest: ` + digest + `
+`
+	actual = HelmRender(t, test)
+	require.Equal(t, "docker.io/http-gateway:0.1.21@"+digest, actual.Deployment.Value.Spec.Template.Spec.Containers[0].Image)
+	require.Equal(t, `{"auths":{"other.example.com":{}}}
+`, actual.ImagePullSecret.Value.StringData[corev1.DockerConfigJsonKey])
+}
+
+func TestImageDigestInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"short digest": {`
+container:
+  image:
+    digest: sha256:0123
+`, "http-gateway image digest sha256:0123 must match sha256:[a-f0-9]{64}"},
+		"uppercase digest": {`
+container:
+  image:
+    digest: sha256:` + strings.Repeat("0123456789ABCDEF", 4) + `
+`, "http-gateway image digest sha256:0123456789ABCDEF"},
+		"test image": {`
+test:
+  image:
+    digest: sha512:0123
+`, "curlimages/curl image digest sha512:0123 must match sha256:[a-f0-9]{64}"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
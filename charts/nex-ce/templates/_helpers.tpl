@@ -55,9 +55,24 @@ Set default values.
   {{- include "nce.requiredValues" . }}
   {{- with .Values }}
     {{- $_ := set .configSecret        "name" (.configSecret.name        | default (printf "%s-config" $name)) }}
+    {{- $_ := set .externalSecret      "name" (.externalSecret.name      | default (printf "%s-config" $name)) }}
     {{- $_ := set .deployment          "name" (.deployment.name          | default $name) }}
+    {{- $_ := set .imagePullSecret     "name" (.imagePullSecret.name     | default (printf "%s-regcred" $name)) }}
+    {{- $_ := set .networkPolicy       "name" (.networkPolicy.name       | default $name) }}
     {{- $_ := set .serviceAccount      "name" (.serviceAccount.name      | default $name) }}
     {{- $_ := set .podDisruptionBudget "name" (.podDisruptionBudget.name | default $name) }}
+    {{- with .test }}
+      {{- $_ := set .               "name" (.name                | default (printf "%s-test" $name)) }}
+      {{- $_ := set .serviceAccount "name" (.serviceAccount.name | default (printf "%s-test" $name)) }}
+      {{- $_ := set .role           "name" (.role.name           | default (printf "%s-test" $name)) }}
+      {{- $_ := set .roleBinding    "name" (.roleBinding.name    | default (printf "%s-test" $name)) }}
+    {{- end }}
+  {{- end }}
+
+  {{- with .Values.container }}
+    {{- if kindIs "invalid" .resources }}
+      {{- $_ := set . "resources" (dict "requests" (dict "cpu" "100m" "memory" "128Mi") "limits" (dict "memory" "512Mi")) }}
+    {{- end }}
   {{- end }}
 
   {{- $values := get (include "tplYaml" (dict "doc" .Values "ctx" $) | fromJson) "doc" }}
@@ -72,6 +87,55 @@ Set required values.
 */}}
 {{- define "nce.requiredValues" }}
   {{- with .Values }}
+    {{- with .deployment }}
+      {{- with .strategy }}
+        {{- if and .type (not (has .type (list "Recreate" "RollingUpdate"))) }}
+          {{- fail (printf "deployment.strategy.type must be Recreate or RollingUpdate, got %s" .type) }}
+        {{- end }}
+        {{- with .rollingUpdate }}
+          {{- if eq ($.Values.deployment.strategy.type | default "RollingUpdate") "Recreate" }}
+            {{- fail "deployment.strategy.rollingUpdate must not be set when deployment.strategy.type is Recreate" }}
+          {{- end }}
+          {{- if and (has (toString (.maxSurge | default 0)) (list "0" "0%")) (has (toString (.maxUnavailable | default 0)) (list "0" "0%")) (or (hasKey . "maxSurge") (hasKey . "maxUnavailable")) }}
+            {{- fail "deployment.strategy.rollingUpdate.maxSurge and maxUnavailable must not both be 0" }}
+          {{- end }}
+        {{- end }}
+      {{- end }}
+      {{- range $k := list "minReadySeconds" "revisionHistoryLimit" "progressDeadlineSeconds" }}
+        {{- if lt (int (get $.Values.deployment $k)) 0 }}
+          {{- fail (printf "deployment.%s must not be negative" $k) }}
+        {{- end }}
+      {{- end }}
+      {{- if and .progressDeadlineSeconds (le (int .progressDeadlineSeconds) (int .minReadySeconds)) }}
+        {{- fail "deployment.progressDeadlineSeconds must be greater than deployment.minReadySeconds" }}
+      {{- end }}
+    {{- end }}
+    {{- $values := dict "nodeSeed" .config.nodeSeed "jwt" .config.creds.jwt "seed" .config.creds.seed "signingKey" .config.credsSigning.signingKey }}
+    {{- $paths := dict "nodeSeed" "config.nodeSeed" "jwt" "config.creds.jwt" "seed" "config.creds.seed" "signingKey" "config.credsSigning.signingKey" }}
+    {{- if .externalSecret.enabled }}
+      {{- $_ := (.externalSecret.secretStoreRef.name | required "externalSecret.secretStoreRef.name is required")}}
+      {{- range $k, $v := .externalSecret.remoteRefs }}
+        {{- if and $v.key (get $values $k) }}
+          {{- fail (printf "%s must not be set when externalSecret.remoteRefs.%s is set" (get $paths $k) $k) }}
+        {{- end }}
+      {{- end }}
+    {{- end }}
+    {{- range $k, $v := .config.secretRefs }}
+      {{- if and $v $v.name }}
+        {{- if not (hasKey $paths $k) }}
+          {{- fail (printf "config.secretRefs.%s is not a supported credential" $k) }}
+        {{- end }}
+        {{- if not $v.key }}
+          {{- fail (printf "config.secretRefs.%s.key is required if name is set" $k) }}
+        {{- end }}
+        {{- if get $values $k }}
+          {{- fail (printf "%s must not be set when config.secretRefs.%s is set" (get $paths $k) $k) }}
+        {{- end }}
+        {{- if and $.Values.externalSecret.enabled (get ($.Values.externalSecret.remoteRefs | default dict) $k | default dict).key }}
+          {{- fail (printf "externalSecret.remoteRefs.%s must not be set when config.secretRefs.%s is set" $k $k) }}
+        {{- end }}
+      {{- end }}
+    {{- end }}
     {{- if and .config.tls.clientCert.cert (not .config.tls.clientCert.key) }}
       {{- fail "config.tls.clientCert.key is required if cert is defined" }}
     {{- end }}
@@ -81,6 +145,93 @@ Set required values.
   {{- end }}
 {{- end }}
 
+{{/*
+nexlets map for config.json as JSON
+namespace is rendered as k8sNamespace for the built-in nexlets
+*/}}
+{{- define "nce.nexlets" -}}
+{{- $defaultNamespace := include "nce.namespace" $ | trim }}
+{{- $namespaces := dict "connectors-kubernetes" (.Values.config.workloadsNamespace | default $defaultNamespace) "containers-kubernetes" (.Values.config.connectorsNamespace | default $defaultNamespace) }}
+{{- $nexlets := dict }}
+{{- range $name, $nexlet := .Values.config.nexlets }}
+  {{- if kindIs "map" $nexlet }}
+    {{- if hasKey $namespaces $name }}
+      {{- $nexlet = merge (dict "k8sNamespace" ($nexlet.namespace | default (get $namespaces $name))) (omit $nexlet "namespace") }}
+    {{- end }}
+    {{- $_ := set $nexlets $name $nexlet }}
+  {{- end }}
+{{- end }}
+{{- toJson $nexlets }}
+{{- end }}
+
+{{/*
+distinct namespaces of the enabled nexlets outside of the release namespace as a JSON list
+*/}}
+{{- define "nce.workloadNamespaces" -}}
+{{- $releaseNamespace := include "nce.namespace" $ | trim }}
+{{- $namespaces := list }}
+{{- range $name, $nexlet := include "nce.nexlets" $ | fromJson }}
+  {{- if and $nexlet.enabled $nexlet.k8sNamespace (ne $nexlet.k8sNamespace $releaseNamespace) }}
+    {{- $namespaces = append $namespaces $nexlet.k8sNamespace }}
+  {{- end }}
+{{- end }}
+{{- $namespaces | uniq | sortAlpha | toJson }}
+{{- end }}
+
+{{/*
+credentials read from existing Secrets as JSON, keyed by credential
+each entry has the Secret name and key, and the env var read by the config init container
+*/}}
+{{- define "nce.secretRefs" -}}
+{{- $envs := dict "nodeSeed" "NCE_SECRET_NODE_SEED" "jwt" "NCE_SECRET_JWT" "seed" "NCE_SECRET_SEED" "signingKey" "NCE_SECRET_SIGNING_KEY" }}
+{{- $refs := dict }}
+{{- range $k, $v := .Values.config.secretRefs }}
+  {{- if and $v $v.name }}
+    {{- $_ := set $refs $k (dict "name" $v.name "key" $v.key "env" (get $envs $k)) }}
+  {{- end }}
+{{- end }}
+{{- toJson $refs }}
+{{- end }}
+
+{{/*
+config.json contents
+credentials read by externalSecret are rendered as ExternalSecret template placeholders
+credentials read by config.secretRefs are rendered as config init container placeholders
+*/}}
+{{- define "nce.configJson" -}}
+{{- $secrets := dict "nodeSeed" .Values.config.nodeSeed "jwt" .Values.config.creds.jwt "seed" .Values.config.creds.seed "signingKey" .Values.config.credsSigning.signingKey }}
+{{- with .Values.externalSecret }}
+  {{- if .enabled }}
+    {{- range $k, $v := .remoteRefs }}
+      {{- if $v.key }}
+        {{- $_ := set $secrets $k (printf "{{ .%s }}" $k) }}
+      {{- end }}
+    {{- end }}
+  {{- end }}
+{{- end -}}
+{{- range $k, $v := include "nce.secretRefs" $ | fromJson }}
+  {{- $_ := set $secrets $k (printf "${%s}" $v.env) }}
+{{- end -}}
+{
+  "name": {{ .Values.config.name | default "nex-ce" | quote }},
+  "nexus": {{ .Values.config.nexus | default "nexus" | quote }},
+  "tags": {{ .Values.config.tags | default (dict) | toJson }},
+  "node_seed": {{ $secrets.nodeSeed | default "" | quote }},
+  "nats": {
+    "servers": [{{ .Values.config.url | quote }}],
+    "seed": {{ $secrets.seed | default "" | quote }},
+    "jwt": {{ $secrets.jwt | default "" | quote }}
+  },
+  "creds_signing_key": {{ $secrets.signingKey | default "" | quote }},
+  "control_account": {{ .Values.config.credsSigning.signingKeyAccount | default "" | quote }},
+  "allow_remote_register": {{ .Values.config.allowRemoteRegister | default false }},
+  "logger": {
+    "level": {{ .Values.config.logLevel | default "info" | lower | quote }}
+  },
+  "nexlets": {{ include "nce.nexlets" $ }}
+}
+{{- end }}
+
 {{/*
 nce.labels
 */}}
@@ -109,7 +260,16 @@ app.kubernetes.io/component: nex-ce
 Print the image
 */}}
 {{- define "nce.image" }}
-{{- $image := printf "%s:%s" .repository .tag }}
+{{- $image := .repository }}
+{{- with .tag }}
+{{- $image = printf "%s:%s" $image . }}
+{{- end }}
+{{- with .digest }}
+{{- if not (regexMatch "^sha256:[a-f0-9]{64}$" .) }}
+{{- fail (printf "%s image digest %s must match sha256:[a-f0-9]{64}" $.repository .) }}
+{{- end }}
+{{- $image = printf "%s@%s" $image . }}
+{{- end }}
 {{- if or .registry .global.image.registry }}
 {{- $image = printf "%s/%s" (.registry | default .global.image.registry) $image }}
 {{- end -}}
@@ -119,6 +279,50 @@ imagePullPolicy: {{ .pullPolicy | default .global.image.pullPolicy }}
 {{- end }}
 {{- end }}
 
+{{/*
+Image pull secrets for all pod specs, the generated imagePullSecret followed by global.image.pullSecretNames
+*/}}
+{{- define "nce.imagePullSecrets" -}}
+{{- $names := list }}
+{{- if .Values.imagePullSecret.enabled }}
+  {{- $names = append $names .Values.imagePullSecret.name }}
+{{- end }}
+{{- $names = concat $names (.Values.global.image.pullSecretNames | default list) | uniq }}
+{{- with $names }}
+imagePullSecrets:
+{{- range . }}
+- name: {{ . | quote }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{/*
+Pod scheduling options, podTemplate options override global.podTemplate options
+*/}}
+{{- define "nce.scheduling" -}}
+{{- $global := .Values.global.podTemplate }}
+{{- with .Values.podTemplate }}
+{{- with .nodeSelector | default $global.nodeSelector }}
+nodeSelector:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .tolerations | default $global.tolerations }}
+tolerations:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .affinity | default $global.affinity }}
+affinity:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .priorityClassName | default $global.priorityClassName }}
+priorityClassName: {{ . | quote }}
+{{- end }}
+{{- with .runtimeClassName | default $global.runtimeClassName }}
+runtimeClassName: {{ . | quote }}
+{{- end }}
+{{- end }}
+{{- end }}
+
 {{/*
 translates env var map to list
 */}}
@@ -135,6 +339,115 @@ translates env var map to list
 {{- end }}
 {{- end }}
 
+{{/*
+Ports from a list of URLs, each item may be a comma separated list of URLs
+*/}}
+{{- define "nce.urlPorts" -}}
+{{- $ports := list }}
+{{- $defaults := dict "nats" 4222 "tls" 4222 "ws" 80 "wss" 443 "http" 80 "https" 443 "postgres" 5432 "postgresql" 5432 }}
+{{- range $urls := . }}
+  {{- range $url := splitList "," $urls }}
+    {{- $url = trim $url }}
+    {{- if $url }}
+      {{- if not (contains "://" $url) }}
+        {{- $url = printf "nats://%s" $url }}
+      {{- end }}
+      {{- $u := urlParse $url }}
+      {{- $port := regexFind "[0-9]+$" (regexFind ":[0-9]+$" $u.host) }}
+      {{- if not $port }}
+        {{- if not (hasKey $defaults $u.scheme) }}
+          {{- fail (printf "unable to determine the port of URL %s" $url) }}
+        {{- end }}
+        {{- $port = get $defaults $u.scheme }}
+      {{- end }}
+      {{- if not (has (int $port) $ports) }}
+        {{- $ports = append $ports (int $port) }}
+      {{- end }}
+    {{- end }}
+  {{- end }}
+{{- end }}
+{{- toJson (dict "ports" $ports) }}
+{{- end }}
+
+{{/*
+Volumes managed by the chart
+*/}}
+{{- define "nce.volumes" -}}
+# tlsCA
+{{- include "nce.tlsCAVolume" $ }}
+# secrets
+{{- range (include "nce.secretNames" $ | fromJson).secretNames }}
+- name: {{ .name | quote }}
+  secret:
+    secretName: {{ .secretName | quote }}
+{{- end }}
+# configSecret
+- name: config
+  secret:
+    secretName: {{ .Values.configSecret.name | default (printf "%s-config" (include "nce.fullname" $)) | quote }}
+{{- if include "nce.secretRefs" $ | fromJson }}
+# config.json rendered from config.secretRefs
+- name: config-rendered
+  emptyDir:
+    medium: Memory
+{{- end }}
+{{- end }}
+
+{{/*
+Fail if a user provided list has names that collide with names managed by the chart, or with each other
+*/}}
+{{- define "nce.checkNames" -}}
+{{- $names := list }}
+{{- range .reserved }}
+  {{- $names = append $names .name }}
+{{- end }}
+{{- range .items }}
+  {{- if not .name }}
+    {{- fail (printf "%s entries require a name" $.key) }}
+  {{- end }}
+  {{- if has .name $names }}
+    {{- fail (printf "%s name %s collides with an existing name" $.key .name) }}
+  {{- end }}
+  {{- $names = append $names .name }}
+{{- end }}
+{{- end }}
+
+{{/*
+Enabled container probes
+*/}}
+{{- define "nce.probes" -}}
+{{- range $name, $probe := .Values.container.probes }}
+{{- if $probe.enabled }}
+{{ $name }}Probe:
+  {{- omit $probe "enabled" | toYaml | nindent 2 }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{/*
+GOMEMLIMIT in bytes derived from container.resources.limits.memory
+*/}}
+{{- define "nce.goMemLimit" -}}
+{{- with .Values.container }}
+{{- if and .goMemLimit.enabled (not (hasKey (.env | default dict) "GOMEMLIMIT")) }}
+  {{- $memory := (.resources | default dict).limits | default dict | dig "memory" "" }}
+  {{- if not $memory }}
+    {{- fail "container.resources.limits.memory is required when container.goMemLimit is enabled" }}
+  {{- end }}
+  {{- if not (kindIs "string" $memory) }}
+    {{- $memory = int64 $memory | toString }}
+  {{- end }}
+  {{- $units := dict "" 1 "k" 1000 "M" 1000000 "G" 1000000000 "T" 1000000000000 "Ki" 1024 "Mi" 1048576 "Gi" 1073741824 "Ti" 1099511627776 }}
+  {{- $value := regexFind "^[0-9]+" $memory }}
+  {{- $unit := trimPrefix $value $memory }}
+  {{- if or (not $value) (not (hasKey $units $unit)) }}
+    {{- fail (cat "container.resources.limits.memory" $memory "can not be used for container.goMemLimit") }}
+  {{- end }}
+  {{- div (mul (atoi $value) (get $units $unit) .goMemLimit.percent) 100 }}
+{{- end }}
+{{- end }}
+{{- end }}
+
 {{/*
 List of external secretNames
 */}}
@@ -0,0 +1,221 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+type Resources struct {
+	ConfigSecret    Resource[corev1.Secret]
+	Deployment      Resource[appsv1.Deployment]
+	ExternalSecret  Resource[map[string]any]
+	ImagePullSecret Resource[corev1.Secret]
+	NetworkPolicy   Resource[networkingv1.NetworkPolicy]
+	ServiceAccount  Resource[corev1.ServiceAccount]
+	Role            Resource[rbacv1.Role]
+	RoleBinding     Resource[rbacv1.RoleBinding]
+}
+
+func (r *Resources) Iter() []MutableResource {
+	return []MutableResource{
+		r.ConfigSecret.Mutable(),
+		r.Deployment.Mutable(),
+		r.ExternalSecret.Mutable(),
+		r.ImagePullSecret.Mutable(),
+		r.NetworkPolicy.Mutable(),
+		r.ServiceAccount.Mutable(),
+		r.Role.Mutable(),
+		r.RoleBinding.Mutable(),
+	}
+}
+
+type Resource[T any] struct {
+	ID       string
+	HasValue bool
+	Value    T
+}
+
+func (r *Resource[T]) Mutable() MutableResource {
+	return MutableResource{
+		ID:        r.ID,
+		HasValueP: &r.HasValue,
+		ValueP:    &r.Value,
+	}
+}
+
+type MutableResource struct {
+	ID        string
+	HasValueP *bool
+	ValueP    any
+}
+
+type K8sResource struct {
+	Kind     string      `yaml:"kind"`
+	Metadata K8sMetadata `yaml:"metadata"`
+}
+
+type K8sMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+}
+
+func GenerateResources(fullName string) *Resources {
+	return &Resources{
+		ConfigSecret: Resource[corev1.Secret]{
+			ID: "Secret/" + fullName + "-config",
+		},
+		Deployment: Resource[appsv1.Deployment]{
+			ID: "Deployment/" + fullName,
+		},
+		ExternalSecret: Resource[map[string]any]{
+			ID: "ExternalSecret/" + fullName + "-config",
+		},
+		ImagePullSecret: Resource[corev1.Secret]{
+			ID: "Secret/" + fullName + "-regcred",
+		},
+		NetworkPolicy: Resource[networkingv1.NetworkPolicy]{
+			ID: "NetworkPolicy/" + fullName,
+		},
+		ServiceAccount: Resource[corev1.ServiceAccount]{
+			ID: "ServiceAccount/" + fullName,
+		},
+		Role: Resource[rbacv1.Role]{
+			ID: "Role/" + fullName + "-role",
+		},
+		RoleBinding: Resource[rbacv1.RoleBinding]{
+			ID: "RoleBinding/" + fullName + "-rolebinding",
+		},
+	}
+}
+
+type Test struct {
+	ChartName   string
+	ReleaseName string
+	Namespace   string
+	FullName    string
+	Values      string
+}
+
+func DefaultTest() *Test {
+	return &Test{
+		ChartName:   "nex-ce",
+		ReleaseName: "nex-ce",
+		Namespace:   "nex-ce",
+		FullName:    "nex-ce",
+		Values: `config:
+  url: nats://my.nats.server
+  nodeSeed: SN_my_node_seed
+  creds:
+    jwt: my_jwt
+    seed: SU_my_seed
+  credsSigning:
+    signingKey: SA_my_signing_key
+    signingKeyAccount: A_my_account
+`,
+	}
+}
+
+func HelmRenderE(t *testing.T, test *Test) (string, error) {
+	t.Helper()
+
+	helmChartPath, err := filepath.Abs("..")
+	require.NoError(t, err)
+
+	tmpFile, err := os.CreateTemp("", "values.*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write([]byte(test.Values)); err != nil {
+		tmpFile.Close()
+		require.NoError(t, err)
+	}
+	err = tmpFile.Close()
+	require.NoError(t, err)
+
+	options := &helm.Options{
+		ValuesFiles:    []string{tmpFile.Name()},
+		KubectlOptions: k8s.NewKubectlOptions("", "", test.Namespace),
+	}
+	return helm.RenderTemplateE(t, options, helmChartPath, test.ReleaseName, nil)
+}
+
+func HelmRender(t *testing.T, test *Test) *Resources {
+	t.Helper()
+
+	output, err := HelmRenderE(t, test)
+	require.NoError(t, err)
+	outputs := strings.Split(output, "---")
+
+	resources := GenerateResources(test.FullName)
+	for _, o := range outputs {
+		meta := K8sResource{}
+		err := yaml.Unmarshal([]byte(o), &meta)
+		require.NoError(t, err)
+
+		id := meta.Kind + "/" + meta.Metadata.Name
+		for _, r := range resources.Iter() {
+			if id == r.ID {
+				helm.UnmarshalK8SYaml(t, o, r.ValueP)
+				*r.HasValueP = true
+				break
+			}
+		}
+	}
+
+	return resources
+}
+
+// HelmRenderKind renders every resource of the given kind, keyed by namespace/name
+// resources without a namespace are keyed by the test namespace
+func HelmRenderKind[T any](t *testing.T, test *Test, kind string) map[string]T {
+	t.Helper()
+
+	output, err := HelmRenderE(t, test)
+	require.NoError(t, err)
+	outputs := strings.Split(output, "---")
+
+	resources := map[string]T{}
+	for _, o := range outputs {
+		meta := K8sResource{}
+		err := yaml.Unmarshal([]byte(o), &meta)
+		require.NoError(t, err)
+
+		if meta.Kind != kind {
+			continue
+		}
+		namespace := meta.Metadata.Namespace
+		if namespace == "" {
+			namespace = test.Namespace
+		}
+
+		var r T
+		helm.UnmarshalK8SYaml(t, o, &r)
+		resources[namespace+"/"+meta.Metadata.Name] = r
+	}
+
+	return resources
+}
+
+// ConfigJSON parses config.json from the rendered config Secret
+func ConfigJSON(t *testing.T, resources *Resources) map[string]any {
+	t.Helper()
+
+	require.True(t, resources.ConfigSecret.HasValue)
+	config := map[string]any{}
+	err := json.Unmarshal([]byte(resources.ConfigSecret.Value.StringData["config.json"]), &config)
+	require.NoError(t, err)
+
+	return config
+}
@@ -0,0 +1,173 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNexletsDefault(t *testing.T) {
+	test := DefaultTest()
+	config := ConfigJSON(t, HelmRender(t, test))
+
+	require.Equal(t, map[string]any{
+		"connectors-kubernetes": map[string]any{
+			"enabled":      true,
+			"k8sNamespace": "nex-ce",
+			"registerType": "connector",
+		},
+		"containers-kubernetes": map[string]any{
+			"enabled":      true,
+			"k8sNamespace": "nex-ce",
+			"registerType": "container",
+		},
+	}, config["nexlets"])
+}
+
+func TestNexlets(t *testing.T) {
+	tests := map[string]struct {
+		values  string
+		nexlets map[string]any
+	}{
+		"default namespaces": {
+			values: `
+  workloadsNamespace: workloads
+  connectorsNamespace: connectors
+`,
+			nexlets: map[string]any{
+				"connectors-kubernetes": map[string]any{
+					"enabled":      true,
+					"k8sNamespace": "workloads",
+					"registerType": "connector",
+				},
+				"containers-kubernetes": map[string]any{
+					"enabled":      true,
+					"k8sNamespace": "connectors",
+					"registerType": "container",
+				},
+			},
+		},
+		"nexlet namespaces": {
+			values: `
+  workloadsNamespace: workloads
+  connectorsNamespace: connectors
+  nexlets:
+    connectors-kubernetes:
+      namespace: my-connectors
+    containers-kubernetes:
+      namespace: my-containers
+      registerType: workload
+`,
+			nexlets: map[string]any{
+				"connectors-kubernetes": map[string]any{
+					"enabled":      true,
+					"k8sNamespace": "my-connectors",
+					"registerType": "connector",
+				},
+				"containers-kubernetes": map[string]any{
+					"enabled":      true,
+					"k8sNamespace": "my-containers",
+					"registerType": "workload",
+				},
+			},
+		},
+		"disabled and removed": {
+			values: `
+  nexlets:
+    connectors-kubernetes:
+      enabled: false
+    containers-kubernetes: null
+`,
+			nexlets: map[string]any{
+				"connectors-kubernetes": map[string]any{
+					"enabled":      false,
+					"k8sNamespace": "nex-ce",
+					"registerType": "connector",
+				},
+			},
+		},
+		"unknown nexlets": {
+			values: `
+  nexlets:
+    containers-kubernetes:
+      maxWorkloads: 10
+    my-nexlet:
+      enabled: true
+      namespace: my-namespace
+      options:
+        foo: bar
+`,
+			nexlets: map[string]any{
+				"connectors-kubernetes": map[string]any{
+					"enabled":      true,
+					"k8sNamespace": "nex-ce",
+					"registerType": "connector",
+				},
+				"containers-kubernetes": map[string]any{
+					"enabled":      true,
+					"k8sNamespace": "nex-ce",
+					"maxWorkloads": float64(10),
+					"registerType": "container",
+				},
+				"my-nexlet": map[string]any{
+					"enabled":   true,
+					"namespace": "my-namespace",
+					"options": map[string]any{
+						"foo": "bar",
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += tc.values
+			config := ConfigJSON(t, HelmRender(t, test))
+			require.Equal(t, tc.nexlets, config["nexlets"])
+		})
+	}
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `networkPolicy:
+  enabled: true
+  dns:
+    enabled: false
+`
+	actual := HelmRender(t, test)
+	require.True(t, actual.NetworkPolicy.HasValue)
+	np := actual.NetworkPolicy.Value.Spec
+
+	// the container does not listen on any port, so nothing is allowed in
+	require.Empty(t, actual.Deployment.Value.Spec.Template.Spec.Containers[0].Ports)
+	require.Equal(t, []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}, np.PolicyTypes)
+	require.Empty(t, np.Ingress)
+
+	require.Equal(t, []networkingv1.NetworkPolicyEgressRule{
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(4222)),
+			},
+		},
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(443)),
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(6443)),
+			},
+		},
+	}, np.Egress)
+}
+
+func networkPolicyPort(protocol corev1.Protocol, port intstr.IntOrString) networkingv1.NetworkPolicyPort {
+	return networkingv1.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &port,
+	}
+}
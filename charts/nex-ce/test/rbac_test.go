@@ -0,0 +1,141 @@
+package test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestWorkloadNamespaces(t *testing.T) {
+	tests := map[string]struct {
+		values     string
+		namespaces []string
+	}{
+		"default": {
+			namespaces: []string{"nex-ce"},
+		},
+		"distinct namespaces": {
+			values: `
+  workloadsNamespace: workloads
+  connectorsNamespace: connectors
+`,
+			namespaces: []string{"connectors", "nex-ce", "workloads"},
+		},
+		"shared namespace": {
+			values: `
+  workloadsNamespace: workloads
+  connectorsNamespace: workloads
+  nexlets:
+    my-nexlet:
+      enabled: true
+      k8sNamespace: workloads
+`,
+			namespaces: []string{"nex-ce", "workloads"},
+		},
+		"release namespace": {
+			values: `
+  workloadsNamespace: nex-ce
+  nexlets:
+    containers-kubernetes:
+      namespace: containers
+`,
+			namespaces: []string{"containers", "nex-ce"},
+		},
+		"disabled nexlets": {
+			values: `
+  nexlets:
+    connectors-kubernetes:
+      enabled: false
+      namespace: connectors
+    containers-kubernetes:
+      namespace: containers
+    my-nexlet:
+      enabled: false
+      k8sNamespace: my-nexlet
+`,
+			namespaces: []string{"containers", "nex-ce"},
+		},
+		"unknown nexlet": {
+			values: `
+  nexlets:
+    my-nexlet:
+      enabled: true
+      k8sNamespace: my-nexlet
+`,
+			namespaces: []string{"my-nexlet", "nex-ce"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += tc.values
+
+			roles := HelmRenderKind[rbacv1.Role](t, test, "Role")
+			bindings := HelmRenderKind[rbacv1.RoleBinding](t, test, "RoleBinding")
+
+			var roleNamespaces, bindingNamespaces []string
+			for id, role := range roles {
+				if role.Name == "nex-ce-role" {
+					roleNamespaces = append(roleNamespaces, strings.Split(id, "/")[0])
+				}
+			}
+			for id, binding := range bindings {
+				if binding.Name != "nex-ce-rolebinding" {
+					continue
+				}
+				bindingNamespaces = append(bindingNamespaces, strings.Split(id, "/")[0])
+				require.Equal(t, []rbacv1.Subject{{
+					Kind:      "ServiceAccount",
+					Name:      "nex-ce",
+					Namespace: "nex-ce",
+				}}, binding.Subjects)
+				require.Equal(t, "nex-ce-role", binding.RoleRef.Name)
+			}
+			slices.Sort(roleNamespaces)
+			slices.Sort(bindingNamespaces)
+
+			require.Equal(t, tc.namespaces, roleNamespaces)
+			require.Equal(t, tc.namespaces, bindingNamespaces)
+			require.Empty(t, HelmRenderKind[corev1.Namespace](t, test, "Namespace"))
+		})
+	}
+}
+
+func TestWorkloadNamespacesCreate(t *testing.T) {
+	test := DefaultTest()
+	test.Values += `
+  workloadsNamespace: workloads
+  connectorsNamespace: connectors
+serviceAccount:
+  workloadNamespaces:
+    namespace:
+      enabled: true
+`
+
+	namespaces := HelmRenderKind[corev1.Namespace](t, test, "Namespace")
+	require.Len(t, namespaces, 2)
+	require.Contains(t, namespaces, "nex-ce/connectors")
+	require.Contains(t, namespaces, "nex-ce/workloads")
+}
+
+func TestWorkloadNamespacesDisabled(t *testing.T) {
+	test := DefaultTest()
+	test.Values += `
+  workloadsNamespace: workloads
+serviceAccount:
+  workloadNamespaces:
+    enabled: false
+    namespace:
+      enabled: true
+`
+
+	bindings := HelmRenderKind[rbacv1.RoleBinding](t, test, "RoleBinding")
+	require.Contains(t, bindings, "nex-ce/nex-ce-rolebinding")
+	require.NotContains(t, bindings, "workloads/nex-ce-rolebinding")
+	require.Empty(t, HelmRenderKind[corev1.Namespace](t, test, "Namespace"))
+}
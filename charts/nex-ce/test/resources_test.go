@@ -0,0 +1,576 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestDeploymentRolloutDefault(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	r := HelmRender(t, test)
+
+	require.True(t, r.Deployment.HasValue)
+	dep := r.Deployment.Value.Spec
+	require.Equal(t, appsv1.DeploymentStrategy{}, dep.Strategy)
+	require.Zero(t, dep.MinReadySeconds)
+	require.Nil(t, dep.RevisionHistoryLimit)
+	require.Nil(t, dep.ProgressDeadlineSeconds)
+}
+
+func TestDeploymentRollout(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+deployment:
+  strategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 1
+      maxUnavailable: 0
+  minReadySeconds: 10
+  revisionHistoryLimit: 0
+  progressDeadlineSeconds: 300
+`
+	r := HelmRender(t, test)
+
+	require.True(t, r.Deployment.HasValue)
+	dep := r.Deployment.Value.Spec
+	maxSurge := intstr.FromInt32(1)
+	maxUnavailable := intstr.FromInt32(0)
+	require.Equal(t, appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       &maxSurge,
+			MaxUnavailable: &maxUnavailable,
+		},
+	}, dep.Strategy)
+	require.Equal(t, int32(10), dep.MinReadySeconds)
+	require.NotNil(t, dep.RevisionHistoryLimit)
+	require.Equal(t, int32(0), *dep.RevisionHistoryLimit)
+	require.NotNil(t, dep.ProgressDeadlineSeconds)
+	require.Equal(t, int32(300), *dep.ProgressDeadlineSeconds)
+
+	test = DefaultTest()
+	test.Values += `
+deployment:
+  strategy:
+    type: Recreate
+`
+	r = HelmRender(t, test)
+	require.Equal(t, appsv1.DeploymentStrategy{
+		Type: appsv1.RecreateDeploymentStrategyType,
+	}, r.Deployment.Value.Spec.Strategy)
+}
+
+func TestDeploymentRolloutInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"unknown strategy": {`
+deployment:
+  strategy:
+    type: BlueGreen
+`, "deployment.strategy.type must be Recreate or RollingUpdate, got BlueGreen"},
+		"recreate with rolling update": {`
+deployment:
+  strategy:
+    type: Recreate
+    rollingUpdate:
+      maxSurge: 1
+`, "deployment.strategy.rollingUpdate must not be set when deployment.strategy.type is Recreate"},
+		"zero surge and unavailable": {`
+deployment:
+  strategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 0
+      maxUnavailable: 0%
+`, "deployment.strategy.rollingUpdate.maxSurge and maxUnavailable must not both be 0"},
+		"negative min ready seconds": {`
+deployment:
+  minReadySeconds: -1
+`, "deployment.minReadySeconds must not be negative"},
+		"progress deadline not greater than min ready seconds": {`
+deployment:
+  minReadySeconds: 30
+  progressDeadlineSeconds: 30
+`, "deployment.progressDeadlineSeconds must be greater than deployment.minReadySeconds"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestImagePullSecrets(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values    string
+		secrets   []corev1.LocalObjectReference
+		generated string
+	}{
+		"generated": {`
+imagePullSecret:
+  enabled: true
+  registry: docker.io
+  username: a
+  password: b
+`, []corev1.LocalObjectReference{{Name: "nex-ce-regcred"}}, `{"auths":{"docker.io":{"auth":"YTpi","password":"b","username":"a"}}}
+`},
+		"existing names": {`
+global:
+  image:
+    pullSecretNames:
+    - mirror-a
+    - mirror-b
+`, []corev1.LocalObjectReference{{Name: "mirror-a"}, {Name: "mirror-b"}}, ""},
+		"both": {`
+global:
+  image:
+    pullSecretNames:
+    - mirror-a
+    - nex-ce-regcred
+imagePullSecret:
+  enabled: true
+`, []corev1.LocalObjectReference{{Name: "nex-ce-regcred"}, {Name: "mirror-a"}}, `{"auths":{"registry.synadia.io":{}}}
+`},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			r := HelmRender(t, test)
+
+			require.True(t, r.Deployment.HasValue)
+			require.Equal(t, value.secrets, r.Deployment.Value.Spec.Template.Spec.ImagePullSecrets)
+			require.Equal(t, value.generated != "", r.ImagePullSecret.HasValue)
+			if r.ImagePullSecret.HasValue {
+				require.Equal(t, corev1.SecretTypeDockerConfigJson, r.ImagePullSecret.Value.Type)
+				require.Equal(t, value.generated, r.ImagePullSecret.Value.StringData[corev1.DockerConfigJsonKey])
+			}
+		})
+	}
+}
+
+func TestSchedulingOptions(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+global:
+  podTemplate:
+    nodeSelector:
+      kubernetes.io/os: linux
+    tolerations:
+    - key: dedicated
+      operator: Equal
+      value: synadia
+      effect: NoSchedule
+    priorityClassName: global-priority
+podTemplate:
+  affinity:
+    nodeAffinity:
+      requiredDuringSchedulingIgnoredDuringExecution:
+        nodeSelectorTerms:
+        - matchExpressions:
+          - key: kubernetes.io/arch
+            operator: In
+            values:
+            - amd64
+  priorityClassName: high-priority
+  runtimeClassName: gvisor
+`
+
+	expected := HelmRender(t, DefaultTest()).Deployment.Value.Spec.Template.Spec
+	pts := &expected
+	pts.NodeSelector = map[string]string{
+		"kubernetes.io/os": "linux",
+	}
+	pts.Tolerations = []corev1.Toleration{
+		{
+			Key:      "dedicated",
+			Operator: corev1.TolerationOpEqual,
+			Value:    "synadia",
+			Effect:   corev1.TaintEffectNoSchedule,
+		},
+	}
+	pts.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{
+								Key:      "kubernetes.io/arch",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{"amd64"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	pts.PriorityClassName = "high-priority"
+	runtimeClassName := "gvisor"
+	pts.RuntimeClassName = &runtimeClassName
+
+	actual := HelmRender(t, test)
+	require.Equal(t, expected, actual.Deployment.Value.Spec.Template.Spec)
+}
+
+func TestContainerResources(t *testing.T) {
+	t.Parallel()
+	goMemLimit := func(ctr corev1.Container) string {
+		for _, env := range ctr.Env {
+			if env.Name == "GOMEMLIMIT" {
+				return env.Value
+			}
+		}
+		return ""
+	}
+
+	test := DefaultTest()
+	ctr := HelmRender(t, test).Deployment.Value.Spec.Template.Spec.Containers[0]
+	require.Equal(t, corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("512Mi"),
+		},
+	}, ctr.Resources)
+	require.Empty(t, goMemLimit(ctr))
+
+	test.Values += `
+container:
+  resources:
+    requests:
+      cpu: 250m
+      memory: 256Mi
+    limits:
+      memory: 1Gi
+  goMemLimit:
+    enabled: true
+    percent: 75
+`
+	ctr = HelmRender(t, test).Deployment.Value.Spec.Template.Spec.Containers[0]
+	require.Equal(t, corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("250m"),
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}, ctr.Resources)
+	require.Equal(t, "805306368", goMemLimit(ctr))
+
+	// env takes precedence over goMemLimit
+	test.Values += `  env:
+    GOMEMLIMIT: 512MiB
+`
+	ctr = HelmRender(t, test).Deployment.Value.Spec.Template.Spec.Containers[0]
+	require.Equal(t, "512MiB", goMemLimit(ctr))
+}
+
+func TestContainerResourcesEmpty(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+container:
+  resources: {}
+`
+	ctr := HelmRender(t, test).Deployment.Value.Spec.Template.Spec.Containers[0]
+	require.Equal(t, corev1.ResourceRequirements{}, ctr.Resources)
+
+	// null uses the defaults
+	test = DefaultTest()
+	test.Values += `
+container:
+  resources: null
+`
+	ctr = HelmRender(t, test).Deployment.Value.Spec.Template.Spec.Containers[0]
+	require.Equal(t, HelmRender(t, DefaultTest()).Deployment.Value.Spec.Template.Spec.Containers[0].Resources, ctr.Resources)
+	require.NotEmpty(t, ctr.Resources.Limits)
+}
+
+func TestContainerResourcesInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"no memory limit": {`
+container:
+  resources:
+    requests:
+      memory: 128Mi
+  goMemLimit:
+    enabled: true
+`, "container.resources.limits.memory is required when container.goMemLimit is enabled"},
+		"decimal memory limit": {`
+container:
+  resources:
+    limits:
+      memory: 1.5Gi
+  goMemLimit:
+    enabled: true
+`, "container.resources.limits.memory 1.5Gi can not be used for container.goMemLimit"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestPodTemplateExtras(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+podTemplate:
+  extraVolumes:
+  - name: ca-bundle
+    emptyDir: {}
+  initContainers:
+  - name: wait-for-nats
+    image: busybox
+    args:
+    - $tplYaml: >
+        {{ .Release.Name }}-nats
+  sidecars:
+  - name: ca-bundle
+    image: busybox
+container:
+  extraVolumeMounts:
+  - name: ca-bundle
+    mountPath: /etc/ca-bundle
+`
+	defaults := HelmRender(t, DefaultTest()).Deployment.Value.Spec.Template.Spec
+	pts := HelmRender(t, test).Deployment.Value.Spec.Template.Spec
+
+	require.Equal(t, append(defaults.Volumes, corev1.Volume{
+		Name: "ca-bundle",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}), pts.Volumes)
+	require.Equal(t, append(defaults.InitContainers, corev1.Container{
+		Name:  "wait-for-nats",
+		Image: "busybox",
+		Args:  []string{test.ReleaseName + "-nats"},
+	}), pts.InitContainers)
+	require.Len(t, pts.Containers, 2)
+	require.Equal(t, corev1.Container{
+		Name:  "ca-bundle",
+		Image: "busybox",
+	}, pts.Containers[1])
+	require.Equal(t, append(defaults.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "ca-bundle",
+		MountPath: "/etc/ca-bundle",
+	}), pts.Containers[0].VolumeMounts)
+}
+
+func TestPodTemplateExtrasInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"volume collides with chart volume": {`
+podTemplate:
+  extraVolumes:
+  - name: config
+    emptyDir: {}
+`, "podTemplate.extraVolumes name config collides with an existing name"},
+		"sidecar collides with config init container": {`
+podTemplate:
+  sidecars:
+  - name: config-init
+    image: busybox
+`, "podTemplate.sidecars name config-init collides with an existing name"},
+		"init container collides with config init container": {`
+podTemplate:
+  initContainers:
+  - name: config-init
+    image: busybox
+`, "podTemplate.initContainers name config-init collides with an existing name"},
+		"duplicate volumes": {`
+podTemplate:
+  extraVolumes:
+  - name: extra
+    emptyDir: {}
+  - name: extra
+    emptyDir: {}
+`, "podTemplate.extraVolumes name extra collides with an existing name"},
+		"sidecar collides with container": {`
+podTemplate:
+  sidecars:
+  - name: nex-ce
+    image: busybox
+`, "podTemplate.sidecars name nex-ce collides with an existing name"},
+		"init container collides with sidecar": {`
+podTemplate:
+  sidecars:
+  - name: ca-bundle
+    image: busybox
+  initContainers:
+  - name: ca-bundle
+    image: busybox
+`, "podTemplate.initContainers name ca-bundle collides with an existing name"},
+		"volume without name": {`
+podTemplate:
+  extraVolumes:
+  - emptyDir: {}
+`, "podTemplate.extraVolumes entries require a name"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	t.Parallel()
+	digest := "sha256:" + strings.Repeat("0123456789abcdef", 4)
+	values := map[string]struct {
+		values string
+		image  string
+	}{
+		"default registry": {`
+container:
+  image:
+    digest: ` + digest + `
+`, "registry.synadia.io/nexce:0.1.8@" + digest},
+		"global registry without tag": {`
+global:
+  image:
+    registry: docker.io
+container:
+  image:
+    tag: ""
+    digest: ` + digest + `
+`, "docker.io/nexce@" + digest},
+		"image registry": {`
+global:
+  image:
+    registry: docker.io
+container:
+  image:
+    registry: mirror.example.com
+    digest: ` + digest + `
+`, "mirror.example.com/nexce:0.1.8@" + digest},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			actual := HelmRender(t, test)
+			require.Equal(t, value.image, actual.Deployment.Value.Spec.Template.Spec.Containers[0].Image)
+		})
+	}
+
+	// the generated pull secret defaults to the same registry as the image
+	test := DefaultTest()
+	test.Values += `
+global:
+  image:
+    registry: mirror.example.com
+imagePullSecret:
+  enabled: true
+container:
+  image:
+    digest: ` + digest + `
+`
+	actual := HelmRender(t, test)
+	require.Equal(t, "mirror.example.com/nexce:0.1.8@"+digest, actual.Deployment.Value.Spec.Template.Spec.Containers[0].Image)
+	require.Equal(t, `{"auths":{"mirror.example.com":{}}}
+`, actual.ImagePullSecret.Value.StringData[corev1.DockerConfigJsonKey])
+
+	// imagePullSecret.registry does not change the image registry
+	test = DefaultTest()
+	test.Values += `
+global:
+  image:
+    registry: mirror.example.com
+imagePullSecret:
+  enabled: true
+  registry: other.example.com
+container:
+  image:
+    registry: docker.io
+    digest: ` + digest + `
+`
+	actual = HelmRender(t, test)
+	require.Equal(t, "docker.io/nexce:0.1.8@"+digest, actual.Deployment.Value.Spec.Template.Spec.Containers[0].Image)
+	require.Equal(t, `{"auths":{"other.example.com":{}}}
+`, actual.ImagePullSecret.Value.StringData[corev1.DockerConfigJsonKey])
+}
+
+func TestImageDigestInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"short digest": {`
+container:
+  image:
+    digest: sha256:0123
+`, "nexce image digest sha256:0123 must match sha256:[a-f0-9]{64}"},
+		"uppercase digest": {`
+container:
+  image:
+    digest: sha256:` + strings.Repeat("0123456789ABCDEF", 4) + `
+`, "nexce image digest sha256:0123456789ABCDEF"},
+		"config init image": {`  nodeSeed: null
+  secretRefs:
+    nodeSeed:
+      name: my-node-secret
+      key: seed
+configInitContainer:
+  image:
+    digest: sha256:0123
+`, "busybox image digest sha256:0123 must match sha256:[a-f0-9]{64}"},
+		"test image": {`
+test:
+  image:
+    digest: sha512:0123
+`, "alpine/k8s image digest sha512:0123 must match sha256:[a-f0-9]{64}"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values += value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
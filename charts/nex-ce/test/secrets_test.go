@@ -0,0 +1,371 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSecretRefs(t *testing.T) {
+	test := DefaultTest()
+	test.Values = `config:
+  url: nats://my.nats.server
+  credsSigning:
+    signingKeyAccount: A_my_account
+  secretRefs:
+    nodeSeed:
+      name: my-node-secret
+      key: seed
+    jwt:
+      name: my-creds-secret
+      key: jwt
+    seed:
+      name: my-creds-secret
+      key: seed
+    signingKey:
+      name: my-signing-secret
+      key: seed
+`
+	resources := HelmRender(t, test)
+
+	configJSON := resources.ConfigSecret.Value.StringData["config.json"]
+	require.NotContains(t, configJSON, "SN_")
+	require.NotContains(t, configJSON, "SU_")
+	require.NotContains(t, configJSON, "SA_")
+
+	config := ConfigJSON(t, resources)
+	require.Equal(t, "${NCE_SECRET_NODE_SEED}", config["node_seed"])
+	require.Equal(t, "${NCE_SECRET_SIGNING_KEY}", config["creds_signing_key"])
+	require.Equal(t, map[string]any{
+		"servers": []any{"nats://my.nats.server"},
+		"seed":    "${NCE_SECRET_SEED}",
+		"jwt":     "${NCE_SECRET_JWT}",
+	}, config["nats"])
+
+	podSpec := resources.Deployment.Value.Spec.Template.Spec
+	require.Len(t, podSpec.InitContainers, 1)
+	initContainer := podSpec.InitContainers[0]
+	require.Equal(t, "config-init", initContainer.Name)
+	require.Equal(t, "docker.io/busybox:1.37.0", initContainer.Image)
+
+	secretKeyRef := func(name, key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: name,
+				},
+				Key: key,
+			},
+		}
+	}
+	require.Equal(t, []corev1.EnvVar{
+		{Name: "NCE_SECRET_JWT", ValueFrom: secretKeyRef("my-creds-secret", "jwt")},
+		{Name: "NCE_SECRET_NODE_SEED", ValueFrom: secretKeyRef("my-node-secret", "seed")},
+		{Name: "NCE_SECRET_SEED", ValueFrom: secretKeyRef("my-creds-secret", "seed")},
+		{Name: "NCE_SECRET_SIGNING_KEY", ValueFrom: secretKeyRef("my-signing-secret", "seed")},
+	}, initContainer.Env)
+	require.Equal(t, []corev1.VolumeMount{
+		{Name: "config", MountPath: "/etc/nex-ce/config-template", ReadOnly: true},
+		{Name: "config-rendered", MountPath: "/etc/nex-ce/config"},
+	}, initContainer.VolumeMounts)
+
+	require.Equal(t, []corev1.VolumeMount{
+		{Name: "config-rendered", MountPath: "/app/config.json", SubPath: "config.json"},
+	}, podSpec.Containers[0].VolumeMounts)
+	require.Contains(t, podSpec.Volumes, corev1.Volume{
+		Name: "config-rendered",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{
+				Medium: corev1.StorageMediumMemory,
+			},
+		},
+	})
+}
+
+func TestSecretRefsConfigInit(t *testing.T) {
+	if _, err := exec.LookPath("awk"); err != nil {
+		t.Skip("awk is not installed")
+	}
+
+	test := DefaultTest()
+	test.Values = `config:
+  url: nats://my.nats.server
+  credsSigning:
+    signingKeyAccount: A_my_account
+  secretRefs:
+    nodeSeed:
+      name: my-node-secret
+      key: seed
+    jwt:
+      name: my-creds-secret
+      key: jwt
+    seed:
+      name: my-creds-secret
+      key: seed
+    signingKey:
+      name: my-signing-secret
+      key: seed
+`
+	resources := HelmRender(t, test)
+	initContainer := resources.Deployment.Value.Spec.Template.Spec.InitContainers[0]
+	require.Equal(t, []string{"sh", "-ec"}, initContainer.Command[:2])
+
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "config-template"), 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "config"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config-template", "config.json"),
+		[]byte(resources.ConfigSecret.Value.StringData["config.json"]), 0o644))
+
+	// & and \ are special in an awk gsub replacement, " and \ must be escaped in json,
+	// and a placeholder in a value must not be replaced
+	cmd := exec.Command("sh", "-ec", strings.ReplaceAll(initContainer.Command[2], "/etc/nex-ce", dir))
+	cmd.Env = append(os.Environ(),
+		"NCE_SECRET_NODE_SEED=SN_node&seed\n",
+		`NCE_SECRET_JWT=my\jwt&"quoted"`,
+		`NCE_SECRET_SEED=SU_seed\\&&`,
+		"NCE_SECRET_SIGNING_KEY=SA_${NCE_SECRET_SEED}",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	rendered, err := os.ReadFile(filepath.Join(dir, "config", "config.json"))
+	require.NoError(t, err)
+	var config map[string]any
+	require.NoError(t, json.Unmarshal(rendered, &config))
+
+	require.Equal(t, "SN_node&seed", config["node_seed"])
+	require.Equal(t, map[string]any{
+		"servers": []any{"nats://my.nats.server"},
+		"seed":    `SU_seed\\&&`,
+		"jwt":     `my\jwt&"quoted"`,
+	}, config["nats"])
+	require.Equal(t, "SA_${NCE_SECRET_SEED}", config["creds_signing_key"])
+}
+
+func TestSecretRefsPartial(t *testing.T) {
+	test := DefaultTest()
+	test.Values = `config:
+  url: nats://my.nats.server
+  nodeSeed: SN_my_node_seed
+  creds:
+    jwt: my_jwt
+  secretRefs:
+    seed:
+      name: my-creds-secret
+      key: seed
+`
+	config := ConfigJSON(t, HelmRender(t, test))
+	require.Equal(t, "SN_my_node_seed", config["node_seed"])
+	require.Equal(t, "", config["creds_signing_key"])
+	require.Equal(t, map[string]any{
+		"servers": []any{"nats://my.nats.server"},
+		"seed":    "${NCE_SECRET_SEED}",
+		"jwt":     "my_jwt",
+	}, config["nats"])
+}
+
+func TestSecretRefsDisabled(t *testing.T) {
+	test := DefaultTest()
+	resources := HelmRender(t, test)
+
+	podSpec := resources.Deployment.Value.Spec.Template.Spec
+	require.Empty(t, podSpec.InitContainers)
+	require.Equal(t, []corev1.VolumeMount{
+		{Name: "config", MountPath: "/app/config.json", SubPath: "config.json"},
+	}, podSpec.Containers[0].VolumeMounts)
+	require.Equal(t, "SN_my_node_seed", ConfigJSON(t, resources)["node_seed"])
+}
+
+func TestSecretRefsInvalid(t *testing.T) {
+	tests := map[string]struct {
+		values string
+		err    string
+	}{
+		"missing key": {
+			values: `config:
+  secretRefs:
+    seed:
+      name: my-creds-secret
+`,
+			err: "config.secretRefs.seed.key is required if name is set",
+		},
+		"value and ref": {
+			values: `config:
+  nodeSeed: SN_my_node_seed
+  secretRefs:
+    nodeSeed:
+      name: my-node-secret
+      key: seed
+`,
+			err: "config.nodeSeed must not be set when config.secretRefs.nodeSeed is set",
+		},
+		"unsupported credential": {
+			values: `config:
+  secretRefs:
+    password:
+      name: my-secret
+      key: password
+`,
+			err: "config.secretRefs.password is not a supported credential",
+		},
+		"external secret and ref": {
+			values: `config:
+  secretRefs:
+    jwt:
+      name: my-creds-secret
+      key: jwt
+externalSecret:
+  enabled: true
+  secretStoreRef:
+    name: my-store
+  remoteRefs:
+    jwt:
+      key: my-remote-jwt
+`,
+			err: "externalSecret.remoteRefs.jwt must not be set when config.secretRefs.jwt is set",
+		},
+		"init container name collision": {
+			values: `config:
+  secretRefs:
+    jwt:
+      name: my-creds-secret
+      key: jwt
+podTemplate:
+  initContainers:
+  - name: config-init
+    image: busybox
+`,
+			err: "config-init",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = tc.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestExternalSecret(t *testing.T) {
+	test := DefaultTest()
+	test.Values = `config:
+  url: nats://my.nats.server
+  credsSigning:
+    signingKeyAccount: A_my_account
+externalSecret:
+  enabled: true
+  secretStoreRef:
+    name: my-store
+  remoteRefs:
+    nodeSeed:
+      key: nex/node
+      property: seed
+    jwt:
+      key: nex/creds
+      property: jwt
+    seed:
+      key: nex/creds
+      property: seed
+    signingKey:
+      key: nex/signing
+`
+	output, err := HelmRenderE(t, test)
+	require.NoError(t, err)
+	for _, s := range []string{"SN_", "SU_", "SA_"} {
+		require.NotContains(t, output, s)
+	}
+
+	resources := HelmRender(t, test)
+	require.False(t, resources.ConfigSecret.HasValue)
+	require.True(t, resources.ExternalSecret.HasValue)
+
+	spec := resources.ExternalSecret.Value["spec"].(map[string]any)
+	require.Equal(t, map[string]any{
+		"name": "my-store",
+		"kind": "SecretStore",
+	}, spec["secretStoreRef"])
+	require.Equal(t, []any{
+		map[string]any{"secretKey": "jwt", "remoteRef": map[string]any{"key": "nex/creds", "property": "jwt"}},
+		map[string]any{"secretKey": "nodeSeed", "remoteRef": map[string]any{"key": "nex/node", "property": "seed"}},
+		map[string]any{"secretKey": "seed", "remoteRef": map[string]any{"key": "nex/creds", "property": "seed"}},
+		map[string]any{"secretKey": "signingKey", "remoteRef": map[string]any{"key": "nex/signing"}},
+	}, spec["data"])
+
+	target := spec["target"].(map[string]any)
+	require.Equal(t, "nex-ce-config", target["name"])
+	template := target["template"].(map[string]any)
+	require.Equal(t, "v2", template["engineVersion"])
+
+	config := map[string]any{}
+	data := template["data"].(map[string]any)
+	err = json.Unmarshal([]byte(data["config.json"].(string)), &config)
+	require.NoError(t, err)
+	require.Equal(t, "{{ .nodeSeed }}", config["node_seed"])
+	require.Equal(t, "{{ .signingKey }}", config["creds_signing_key"])
+	require.Equal(t, "A_my_account", config["control_account"])
+	require.Equal(t, map[string]any{
+		"servers": []any{"nats://my.nats.server"},
+		"seed":    "{{ .seed }}",
+		"jwt":     "{{ .jwt }}",
+	}, config["nats"])
+
+	// the Deployment still mounts the Secret created by the ExternalSecret
+	volumes := resources.Deployment.Value.Spec.Template.Spec.Volumes
+	require.Contains(t, volumes, corev1.Volume{
+		Name: "config",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: "nex-ce-config",
+			},
+		},
+	})
+}
+
+func TestExternalSecretPartial(t *testing.T) {
+	test := DefaultTest()
+	test.Values = `config:
+  url: nats://my.nats.server
+  nodeSeed: SN_my_node_seed
+  creds:
+    jwt: my_jwt
+externalSecret:
+  enabled: true
+  secretStoreRef:
+    name: my-store
+  remoteRefs:
+    seed:
+      key: nex/creds
+`
+	output, err := HelmRenderE(t, test)
+	require.NoError(t, err)
+	for _, o := range strings.Split(output, "---") {
+		require.NotContains(t, o, "kind: Secret\n")
+	}
+
+	resources := HelmRender(t, test)
+	require.False(t, resources.ConfigSecret.HasValue)
+	spec := resources.ExternalSecret.Value["spec"].(map[string]any)
+	require.Equal(t, []any{
+		map[string]any{"secretKey": "seed", "remoteRef": map[string]any{"key": "nex/creds"}},
+	}, spec["data"])
+
+	config := map[string]any{}
+	data := spec["target"].(map[string]any)["template"].(map[string]any)["data"].(map[string]any)
+	err = json.Unmarshal([]byte(data["config.json"].(string)), &config)
+	require.NoError(t, err)
+	require.Equal(t, "SN_my_node_seed", config["node_seed"])
+	require.Equal(t, map[string]any{
+		"servers": []any{"nats://my.nats.server"},
+		"seed":    "{{ .seed }}",
+		"jwt":     "my_jwt",
+	}, config["nats"])
+}
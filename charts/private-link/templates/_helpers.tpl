@@ -55,9 +55,36 @@ Set default values.
   {{- include "spl.requiredValues" . }}
   {{- with .Values }}
     {{- $_ := set .tokenSecret         "name" (.tokenSecret.name         | default (printf "%s-token" $name)) }}
+    {{- $_ := set .externalSecret      "name" (.externalSecret.name      | default (printf "%s-token" $name)) }}
     {{- $_ := set .deployment          "name" (.deployment.name          | default $name) }}
+    {{- $_ := set .imagePullSecret     "name" (.imagePullSecret.name     | default (printf "%s-regcred" $name)) }}
+    {{- $_ := set .networkPolicy       "name" (.networkPolicy.name       | default $name) }}
     {{- $_ := set .serviceAccount      "name" (.serviceAccount.name      | default $name) }}
+    {{- $_ := set .autoscaling         "name" (.autoscaling.name         | default $name) }}
     {{- $_ := set .podDisruptionBudget "name" (.podDisruptionBudget.name | default $name) }}
+    {{- with .test }}
+      {{- $_ := set .               "name" (.name                | default (printf "%s-test" $name)) }}
+      {{- $_ := set .serviceAccount "name" (.serviceAccount.name | default (printf "%s-test" $name)) }}
+      {{- $_ := set .role           "name" (.role.name           | default (printf "%s-test" $name)) }}
+      {{- $_ := set .roleBinding    "name" (.roleBinding.name    | default (printf "%s-test" $name)) }}
+    {{- end }}
+  {{- end }}
+
+  {{- with .Values.container }}
+    {{- if kindIs "invalid" .resources }}
+      {{- $_ := set . "resources" (dict "requests" (dict "cpu" "50m" "memory" "64Mi") "limits" (dict "memory" "256Mi")) }}
+    {{- end }}
+  {{- end }}
+
+  {{- with .Values.autoscaling }}
+    {{- if .enabled }}
+      {{- if gt (int .minReplicas) (int .maxReplicas) }}
+        {{- fail "autoscaling.minReplicas must not be greater than autoscaling.maxReplicas" }}
+      {{- end }}
+      {{- if not (or .targetCPUUtilizationPercentage .targetMemoryUtilizationPercentage .metrics) }}
+        {{- fail "autoscaling requires targetCPUUtilizationPercentage, targetMemoryUtilizationPercentage or metrics" }}
+      {{- end }}
+    {{- end }}
   {{- end }}
 
   {{- $values := get (include "tplYaml" (dict "doc" .Values "ctx" $) | fromJson) "doc" }}
@@ -72,7 +99,38 @@ Set required values.
 */}}
 {{- define "spl.requiredValues" }}
   {{- with .Values }}
-    {{- $_ := (.config.token | required "config.token is required")}}
+    {{- with .deployment }}
+      {{- with .strategy }}
+        {{- if and .type (not (has .type (list "Recreate" "RollingUpdate"))) }}
+          {{- fail (printf "deployment.strategy.type must be Recreate or RollingUpdate, got %s" .type) }}
+        {{- end }}
+        {{- with .rollingUpdate }}
+          {{- if eq ($.Values.deployment.strategy.type | default "RollingUpdate") "Recreate" }}
+            {{- fail "deployment.strategy.rollingUpdate must not be set when deployment.strategy.type is Recreate" }}
+          {{- end }}
+          {{- if and (has (toString (.maxSurge | default 0)) (list "0" "0%")) (has (toString (.maxUnavailable | default 0)) (list "0" "0%")) (or (hasKey . "maxSurge") (hasKey . "maxUnavailable")) }}
+            {{- fail "deployment.strategy.rollingUpdate.maxSurge and maxUnavailable must not both be 0" }}
+          {{- end }}
+        {{- end }}
+      {{- end }}
+      {{- range $k := list "minReadySeconds" "revisionHistoryLimit" "progressDeadlineSeconds" }}
+        {{- if lt (int (get $.Values.deployment $k)) 0 }}
+          {{- fail (printf "deployment.%s must not be negative" $k) }}
+        {{- end }}
+      {{- end }}
+      {{- if and .progressDeadlineSeconds (le (int .progressDeadlineSeconds) (int .minReadySeconds)) }}
+        {{- fail "deployment.progressDeadlineSeconds must be greater than deployment.minReadySeconds" }}
+      {{- end }}
+    {{- end }}
+    {{- if .externalSecret.enabled }}
+      {{- if .config.token }}
+        {{- fail "config.token must not be set when externalSecret is enabled" }}
+      {{- end }}
+      {{- $_ := (.externalSecret.secretStoreRef.name | required "externalSecret.secretStoreRef.name is required")}}
+      {{- $_ := (.externalSecret.remoteRefs.token.key | required "externalSecret.remoteRefs.token.key is required")}}
+    {{- else }}
+      {{- $_ := (.config.token | required "config.token is required")}}
+    {{- end }}
     {{- if and .config.tls.clientCert.cert (not .config.tls.clientCert.key) }}
       {{- fail "config.tls.clientCert.key is required if cert is defined" }}
     {{- end }}
@@ -110,7 +168,16 @@ app.kubernetes.io/component: private-link
 Print the image
 */}}
 {{- define "spl.image" }}
-{{- $image := printf "%s:%s" .repository .tag }}
+{{- $image := .repository }}
+{{- with .tag }}
+{{- $image = printf "%s:%s" $image . }}
+{{- end }}
+{{- with .digest }}
+{{- if not (regexMatch "^sha256:[a-f0-9]{64}$" .) }}
+{{- fail (printf "%s image digest %s must match sha256:[a-f0-9]{64}" $.repository .) }}
+{{- end }}
+{{- $image = printf "%s@%s" $image . }}
+{{- end }}
 {{- if or .registry .global.image.registry }}
 {{- $image = printf "%s/%s" (.registry | default .global.image.registry) $image }}
 {{- end -}}
@@ -120,6 +187,50 @@ imagePullPolicy: {{ .pullPolicy | default .global.image.pullPolicy }}
 {{- end }}
 {{- end }}
 
+{{/*
+Image pull secrets for all pod specs, the generated imagePullSecret followed by global.image.pullSecretNames
+*/}}
+{{- define "spl.imagePullSecrets" -}}
+{{- $names := list }}
+{{- if .Values.imagePullSecret.enabled }}
+  {{- $names = append $names .Values.imagePullSecret.name }}
+{{- end }}
+{{- $names = concat $names (.Values.global.image.pullSecretNames | default list) | uniq }}
+{{- with $names }}
+imagePullSecrets:
+{{- range . }}
+- name: {{ . | quote }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{/*
+Pod scheduling options, podTemplate options override global.podTemplate options
+*/}}
+{{- define "spl.scheduling" -}}
+{{- $global := .Values.global.podTemplate }}
+{{- with .Values.podTemplate }}
+{{- with .nodeSelector | default $global.nodeSelector }}
+nodeSelector:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .tolerations | default $global.tolerations }}
+tolerations:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .affinity | default $global.affinity }}
+affinity:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .priorityClassName | default $global.priorityClassName }}
+priorityClassName: {{ . | quote }}
+{{- end }}
+{{- with .runtimeClassName | default $global.runtimeClassName }}
+runtimeClassName: {{ . | quote }}
+{{- end }}
+{{- end }}
+{{- end }}
+
 {{/*
 translates env var map to list
 */}}
@@ -136,6 +247,105 @@ translates env var map to list
 {{- end }}
 {{- end }}
 
+{{/*
+Ports from a list of URLs, each item may be a comma separated list of URLs
+*/}}
+{{- define "spl.urlPorts" -}}
+{{- $ports := list }}
+{{- $defaults := dict "nats" 4222 "tls" 4222 "ws" 80 "wss" 443 "http" 80 "https" 443 "postgres" 5432 "postgresql" 5432 }}
+{{- range $urls := . }}
+  {{- range $url := splitList "," $urls }}
+    {{- $url = trim $url }}
+    {{- if $url }}
+      {{- if not (contains "://" $url) }}
+        {{- $url = printf "nats://%s" $url }}
+      {{- end }}
+      {{- $u := urlParse $url }}
+      {{- $port := regexFind "[0-9]+$" (regexFind ":[0-9]+$" $u.host) }}
+      {{- if not $port }}
+        {{- if not (hasKey $defaults $u.scheme) }}
+          {{- fail (printf "unable to determine the port of URL %s" $url) }}
+        {{- end }}
+        {{- $port = get $defaults $u.scheme }}
+      {{- end }}
+      {{- if not (has (int $port) $ports) }}
+        {{- $ports = append $ports (int $port) }}
+      {{- end }}
+    {{- end }}
+  {{- end }}
+{{- end }}
+{{- toJson (dict "ports" $ports) }}
+{{- end }}
+
+{{/*
+Volumes managed by the chart
+*/}}
+{{- define "spl.volumes" -}}
+# tlsCA
+{{- include "spl.tlsCAVolume" $ }}
+# secrets
+{{- range (include "spl.secretNames" $ | fromJson).secretNames }}
+- name: {{ .name | quote }}
+  secret:
+    secretName: {{ .secretName | quote }}
+{{- end }}
+{{- end }}
+
+{{/*
+Fail if a user provided list has names that collide with names managed by the chart, or with each other
+*/}}
+{{- define "spl.checkNames" -}}
+{{- $names := list }}
+{{- range .reserved }}
+  {{- $names = append $names .name }}
+{{- end }}
+{{- range .items }}
+  {{- if not .name }}
+    {{- fail (printf "%s entries require a name" $.key) }}
+  {{- end }}
+  {{- if has .name $names }}
+    {{- fail (printf "%s name %s collides with an existing name" $.key .name) }}
+  {{- end }}
+  {{- $names = append $names .name }}
+{{- end }}
+{{- end }}
+
+{{/*
+Enabled container probes
+*/}}
+{{- define "spl.probes" -}}
+{{- range $name, $probe := .Values.container.probes }}
+{{- if $probe.enabled }}
+{{ $name }}Probe:
+  {{- omit $probe "enabled" | toYaml | nindent 2 }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{/*
+GOMEMLIMIT in bytes derived from container.resources.limits.memory
+*/}}
+{{- define "spl.goMemLimit" -}}
+{{- with .Values.container }}
+{{- if and .goMemLimit.enabled (not (hasKey (.env | default dict) "GOMEMLIMIT")) }}
+  {{- $memory := (.resources | default dict).limits | default dict | dig "memory" "" }}
+  {{- if not $memory }}
+    {{- fail "container.resources.limits.memory is required when container.goMemLimit is enabled" }}
+  {{- end }}
+  {{- if not (kindIs "string" $memory) }}
+    {{- $memory = int64 $memory | toString }}
+  {{- end }}
+  {{- $units := dict "" 1 "k" 1000 "M" 1000000 "G" 1000000000 "T" 1000000000000 "Ki" 1024 "Mi" 1048576 "Gi" 1073741824 "Ti" 1099511627776 }}
+  {{- $value := regexFind "^[0-9]+" $memory }}
+  {{- $unit := trimPrefix $value $memory }}
+  {{- if or (not $value) (not (hasKey $units $unit)) }}
+    {{- fail (cat "container.resources.limits.memory" $memory "can not be used for container.goMemLimit") }}
+  {{- end }}
+  {{- div (mul (atoi $value) (get $units $unit) .goMemLimit.percent) 100 }}
+{{- end }}
+{{- end }}
+{{- end }}
+
 {{/*
 List of external secretNames
 */}}
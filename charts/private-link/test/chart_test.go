@@ -12,14 +12,26 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 type Resources struct {
 	Deployment          Resource[appsv1.Deployment]
+	ExternalSecret      Resource[map[string]any]
+	HPA                 Resource[autoscalingv2.HorizontalPodAutoscaler]
+	ImagePullSecret     Resource[corev1.Secret]
+	NetworkPolicy       Resource[networkingv1.NetworkPolicy]
 	PodDisruptionBudget Resource[policyv1.PodDisruptionBudget]
 	ServiceAccount      Resource[corev1.ServiceAccount]
+	TokenSecret         Resource[corev1.Secret]
+	TestPod             Resource[corev1.Pod]
+	TestServiceAccount  Resource[corev1.ServiceAccount]
+	TestRole            Resource[rbacv1.Role]
+	TestRoleBinding     Resource[rbacv1.RoleBinding]
 	ExtraConfigMap      Resource[corev1.ConfigMap]
 	ExtraService        Resource[corev1.Service]
 }
@@ -27,7 +39,16 @@ type Resources struct {
 func (r *Resources) Iter() []MutableResource {
 	return []MutableResource{
 		r.Deployment.Mutable(),
+		r.ExternalSecret.Mutable(),
+		r.HPA.Mutable(),
+		r.ImagePullSecret.Mutable(),
+		r.NetworkPolicy.Mutable(),
 		r.ServiceAccount.Mutable(),
+		r.TokenSecret.Mutable(),
+		r.TestPod.Mutable(),
+		r.TestServiceAccount.Mutable(),
+		r.TestRole.Mutable(),
+		r.TestRoleBinding.Mutable(),
 		r.ExtraConfigMap.Mutable(),
 		r.ExtraService.Mutable(),
 	}
@@ -67,12 +88,39 @@ func GenerateResources(fullName string) *Resources {
 		Deployment: Resource[appsv1.Deployment]{
 			ID: "Deployment/" + fullName,
 		},
+		ExternalSecret: Resource[map[string]any]{
+			ID: "ExternalSecret/" + fullName + "-token",
+		},
+		HPA: Resource[autoscalingv2.HorizontalPodAutoscaler]{
+			ID: "HorizontalPodAutoscaler/" + fullName,
+		},
+		ImagePullSecret: Resource[corev1.Secret]{
+			ID: "Secret/" + fullName + "-regcred",
+		},
+		NetworkPolicy: Resource[networkingv1.NetworkPolicy]{
+			ID: "NetworkPolicy/" + fullName,
+		},
 		PodDisruptionBudget: Resource[policyv1.PodDisruptionBudget]{
 			ID: "PodDisruptionBudget/" + fullName,
 		},
 		ServiceAccount: Resource[corev1.ServiceAccount]{
 			ID: "ServiceAccount/" + fullName,
 		},
+		TokenSecret: Resource[corev1.Secret]{
+			ID: "Secret/" + fullName + "-token",
+		},
+		TestPod: Resource[corev1.Pod]{
+			ID: "Pod/" + fullName + "-test",
+		},
+		TestServiceAccount: Resource[corev1.ServiceAccount]{
+			ID: "ServiceAccount/" + fullName + "-test",
+		},
+		TestRole: Resource[rbacv1.Role]{
+			ID: "Role/" + fullName + "-test",
+		},
+		TestRoleBinding: Resource[rbacv1.RoleBinding]{
+			ID: "RoleBinding/" + fullName + "-test",
+		},
 		ExtraConfigMap: Resource[corev1.ConfigMap]{
 			ID: "ConfigMap/" + fullName + "-extra",
 		},
@@ -103,7 +151,7 @@ func DefaultTest() *Test {
 	}
 }
 
-func HelmRender(t *testing.T, test *Test) *Resources {
+func HelmRenderE(t *testing.T, test *Test) (string, error) {
 	t.Helper()
 
 	helmChartPath, err := filepath.Abs("..")
@@ -124,7 +172,14 @@ func HelmRender(t *testing.T, test *Test) *Resources {
 		ValuesFiles:    []string{tmpFile.Name()},
 		KubectlOptions: k8s.NewKubectlOptions("", "", test.Namespace),
 	}
-	output := helm.RenderTemplate(t, options, helmChartPath, test.ReleaseName, nil)
+	return helm.RenderTemplateE(t, options, helmChartPath, test.ReleaseName, nil)
+}
+
+func HelmRender(t *testing.T, test *Test) *Resources {
+	t.Helper()
+
+	output, err := HelmRenderE(t, test)
+	require.NoError(t, err)
 	outputs := strings.Split(output, "---")
 
 	resources := GenerateResources("private-link")
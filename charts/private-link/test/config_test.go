@@ -3,7 +3,10 @@ package test
 import (
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func TestMTLS(t *testing.T) {
@@ -195,6 +198,7 @@ func TestMTLSInsecure(t *testing.T) {
 `
 
 	expected := DefaultResources(t, test)
+	expected.TokenSecret.Value.StringData["token"] = "agt_my_other_token"
 
 	expected.Deployment.Value.Spec.Template.Spec.Containers[0].Env = []corev1.EnvVar{
 		{
@@ -238,3 +242,155 @@ func TestMTLSInsecure(t *testing.T) {
 
 	RenderAndCheck(t, test, expected)
 }
+
+func TestExternalSecret(t *testing.T) {
+	test := DefaultTest()
+	test.Values = `config:
+  natsURL: nats://connect.ngs.global
+externalSecret:
+  enabled: true
+  secretStoreRef:
+    name: vault
+    kind: ClusterSecretStore
+  remoteRefs:
+    token:
+      key: synadia/private-link
+      property: token
+`
+
+	expected := DefaultResources(t, test)
+	expected.TokenSecret.HasValue = false
+
+	expected.ExternalSecret.HasValue = true
+	spec := expected.ExternalSecret.Value["spec"].(map[string]any)
+	spec["secretStoreRef"] = map[string]any{
+		"name": "vault",
+		"kind": "ClusterSecretStore",
+	}
+	spec["data"] = []any{
+		map[string]any{
+			"secretKey": "token",
+			"remoteRef": map[string]any{
+				"key":      "synadia/private-link",
+				"property": "token",
+			},
+		},
+	}
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestExternalSecretInvalid(t *testing.T) {
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"plaintext token": {`config:
+  token: agt_my_token
+externalSecret:
+  enabled: true
+  secretStoreRef:
+    name: vault
+  remoteRefs:
+    token:
+      key: synadia/private-link
+`, "config.token must not be set when externalSecret is enabled"},
+		"no secret store": {`externalSecret:
+  enabled: true
+  remoteRefs:
+    token:
+      key: synadia/private-link
+`, "externalSecret.secretStoreRef.name is required"},
+		"no remote key": {`externalSecret:
+  enabled: true
+  secretStoreRef:
+    name: vault
+`, "externalSecret.remoteRefs.token.key is required"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `config:
+  platformURL: https://cp.example.com:8443
+  natsURL: nats://a.example.com:4223,tls://b.example.com
+  token: agt_my_token
+networkPolicy:
+  enabled: true
+  dns:
+    enabled: false
+  extraIngress:
+  - ports:
+    - port: health
+`
+	expected := DefaultResources(t, test)
+	expected.Deployment.Value.Spec.Template.Spec.Containers[0].Args = []string{
+		"--nats-url=nats://a.example.com:4223,tls://b.example.com",
+		"--platform-url=https://cp.example.com:8443",
+	}
+
+	healthPort := intstr.FromString("health")
+	expected.NetworkPolicy.HasValue = true
+	np := &expected.NetworkPolicy.Value.Spec
+	np.Ingress = append(np.Ingress, networkingv1.NetworkPolicyIngressRule{
+		Ports: []networkingv1.NetworkPolicyPort{
+			{Port: &healthPort},
+		},
+	})
+	np.Egress = []networkingv1.NetworkPolicyEgressRule{
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(4223)),
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(4222)),
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(8443)),
+			},
+		},
+	}
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestHelmTest(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+  healthPort: 9090
+`
+	expected := DefaultResources(t, test)
+	expected.Deployment.Value.Spec.Template.Spec.Containers[0].Args = append(
+		expected.Deployment.Value.Spec.Template.Spec.Containers[0].Args, "--health-port=9090")
+	expected.Deployment.Value.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort = 9090
+	expected.TestPod.Value.Spec.Containers[0].Env[3].Value = "9090"
+
+	RenderAndCheck(t, test, expected)
+
+	test.Values = `config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+networkPolicy:
+  enabled: true
+test:
+  enabled: false
+`
+	expected = DefaultResources(t, test)
+	expected.NetworkPolicy.HasValue = true
+	expected.NetworkPolicy.Value.Spec.Ingress = nil
+	expected.TestPod.HasValue = false
+	expected.TestServiceAccount.HasValue = false
+	expected.TestRole.HasValue = false
+	expected.TestRoleBinding.HasValue = false
+
+	RenderAndCheck(t, test, expected)
+}
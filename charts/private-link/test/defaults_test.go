@@ -6,8 +6,12 @@ import (
 
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -71,6 +75,13 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 			"helm.sh/chart":                dd.HelmChartLabel,
 		}
 	}
+	plLabelsAny := func() map[string]any {
+		labels := map[string]any{}
+		for k, v := range plLabels() {
+			labels[k] = v
+		}
+		return labels
+	}
 	plSelectorLabels := func() map[string]string {
 		return map[string]string{
 			"app.kubernetes.io/component": "private-link",
@@ -79,10 +90,30 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 		}
 	}
 
+	testLabels := func() map[string]string {
+		labels := plLabels()
+		labels["app.kubernetes.io/component"] = "private-link-test"
+		return labels
+	}
+	testSelectorLabels := func() map[string]string {
+		labels := plSelectorLabels()
+		labels["app.kubernetes.io/component"] = "private-link-test"
+		return labels
+	}
+	testHookAnnotations := func() map[string]string {
+		return map[string]string{
+			"helm.sh/hook":               "test",
+			"helm.sh/hook-weight":        "-1",
+			"helm.sh/hook-delete-policy": "before-hook-creation,hook-succeeded",
+		}
+	}
+	healthPort := intstr.FromString("health")
+
 	replicas2 := int32(2)
 	trueBool := true
 	falseBool := false
 	runAsUser := int64(1000)
+	cpuUtilization := int32(80)
 
 	return &Resources{
 		Deployment: Resource[appsv1.Deployment]{
@@ -167,6 +198,15 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 										TimeoutSeconds:      5,
 										FailureThreshold:    60,
 									},
+									Resources: corev1.ResourceRequirements{
+										Requests: corev1.ResourceList{
+											corev1.ResourceCPU:    resource.MustParse("50m"),
+											corev1.ResourceMemory: resource.MustParse("64Mi"),
+										},
+										Limits: corev1.ResourceList{
+											corev1.ResourceMemory: resource.MustParse("256Mi"),
+										},
+									},
 									Args: []string{
 										"--nats-url=nats://connect.ngs.global",
 									},
@@ -191,6 +231,133 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 				},
 			},
 		},
+		ExternalSecret: Resource[map[string]any]{
+			ID:       dr.ExternalSecret.ID,
+			HasValue: false,
+			Value: map[string]any{
+				"apiVersion": "external-secrets.io/v1beta1",
+				"kind":       "ExternalSecret",
+				"metadata": map[string]any{
+					"name":   fullName + "-token",
+					"labels": plLabelsAny(),
+				},
+				"spec": map[string]any{
+					"refreshInterval": "1h",
+					"secretStoreRef": map[string]any{
+						"kind": "SecretStore",
+					},
+					"target": map[string]any{
+						"name":           fullName + "-token",
+						"creationPolicy": "Owner",
+					},
+				},
+			},
+		},
+		HPA: Resource[autoscalingv2.HorizontalPodAutoscaler]{
+			ID:       dr.HPA.ID,
+			HasValue: false,
+			Value: autoscalingv2.HorizontalPodAutoscaler{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "HorizontalPodAutoscaler",
+					APIVersion: "autoscaling/v2",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: plLabels(),
+				},
+				Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+					ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+						APIVersion: "apps/v1",
+						Kind:       "Deployment",
+						Name:       fullName,
+					},
+					MinReplicas: &replicas2,
+					MaxReplicas: 10,
+					Metrics: []autoscalingv2.MetricSpec{
+						{
+							Type: autoscalingv2.ResourceMetricSourceType,
+							Resource: &autoscalingv2.ResourceMetricSource{
+								Name: corev1.ResourceCPU,
+								Target: autoscalingv2.MetricTarget{
+									Type:               autoscalingv2.UtilizationMetricType,
+									AverageUtilization: &cpuUtilization,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		ImagePullSecret: Resource[corev1.Secret]{
+			ID:       dr.ImagePullSecret.ID,
+			HasValue: false,
+			Value: corev1.Secret{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Secret",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-regcred",
+					Labels: plLabels(),
+				},
+				Type: corev1.SecretTypeDockerConfigJson,
+				StringData: map[string]string{
+					corev1.DockerConfigJsonKey: `{"auths":{"registry.synadia.io":{}}}
+`,
+				},
+			},
+		},
+		NetworkPolicy: Resource[networkingv1.NetworkPolicy]{
+			ID:       dr.NetworkPolicy.ID,
+			HasValue: false,
+			Value: networkingv1.NetworkPolicy{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "NetworkPolicy",
+					APIVersion: "networking.k8s.io/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName,
+					Labels: plLabels(),
+				},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: v1.LabelSelector{
+						MatchLabels: plSelectorLabels(),
+					},
+					PolicyTypes: []networkingv1.PolicyType{
+						networkingv1.PolicyTypeIngress,
+						networkingv1.PolicyTypeEgress,
+					},
+					Ingress: []networkingv1.NetworkPolicyIngressRule{
+						{
+							From: []networkingv1.NetworkPolicyPeer{
+								{
+									PodSelector: &v1.LabelSelector{
+										MatchLabels: testSelectorLabels(),
+									},
+								},
+							},
+							Ports: []networkingv1.NetworkPolicyPort{
+								networkPolicyPort(corev1.ProtocolTCP, healthPort),
+							},
+						},
+					},
+					Egress: []networkingv1.NetworkPolicyEgressRule{
+						{
+							Ports: []networkingv1.NetworkPolicyPort{
+								networkPolicyPort(corev1.ProtocolUDP, intstr.FromInt32(53)),
+								networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(53)),
+							},
+						},
+						{
+							Ports: []networkingv1.NetworkPolicyPort{
+								networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(4222)),
+								networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(443)),
+							},
+						},
+					},
+				},
+			},
+		},
 		PodDisruptionBudget: Resource[policyv1.PodDisruptionBudget]{
 			ID:       dr.PodDisruptionBudget.ID,
 			HasValue: true,
@@ -225,6 +392,153 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 				},
 			},
 		},
+		TokenSecret: Resource[corev1.Secret]{
+			ID:       dr.TokenSecret.ID,
+			HasValue: true,
+			Value: corev1.Secret{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Secret",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-token",
+					Labels: plLabels(),
+				},
+				Type: corev1.SecretTypeOpaque,
+				StringData: map[string]string{
+					"token": "agt_my_token",
+				},
+			},
+		},
+		TestPod: Resource[corev1.Pod]{
+			ID:       dr.TestPod.ID,
+			HasValue: true,
+			Value: corev1.Pod{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Pod",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:   fullName + "-test",
+					Labels: testLabels(),
+					Annotations: map[string]string{
+						"helm.sh/hook":               "test",
+						"helm.sh/hook-delete-policy": "before-hook-creation,hook-succeeded",
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ServiceAccountName: fullName + "-test",
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsUser:    &runAsUser,
+						RunAsNonRoot: &trueBool,
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "docker.io/alpine/k8s:1.31.4",
+							Env: []corev1.EnvVar{
+								{
+									Name:  "HOME",
+									Value: "/tmp",
+								},
+								{
+									Name:  "DEPLOYMENT",
+									Value: fullName,
+								},
+								{
+									Name:  "SELECTOR",
+									Value: "app.kubernetes.io/component=private-link,app.kubernetes.io/instance=" + releaseName + ",app.kubernetes.io/name=" + chartName,
+								},
+								{
+									Name:  "HEALTH_PORT",
+									Value: "8080",
+								},
+							},
+							Command: []string{
+								"sh",
+								"-ec",
+								`kubectl rollout status "deployment/${DEPLOYMENT}" --timeout=120s
+for ip in $(kubectl get pods -l "${SELECTOR}" --field-selector=status.phase=Running -o jsonpath='{.items[*].status.podIP}'); do
+  echo "checking http://${ip}:${HEALTH_PORT}/readyz"
+  curl -fsS --retry 5 --retry-connrefused --retry-delay 2 "http://${ip}:${HEALTH_PORT}/readyz"
+done
+`,
+							},
+						},
+					},
+				},
+			},
+		},
+		TestServiceAccount: Resource[corev1.ServiceAccount]{
+			ID:       dr.TestServiceAccount.ID,
+			HasValue: true,
+			Value: corev1.ServiceAccount{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "ServiceAccount",
+					APIVersion: "v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:        fullName + "-test",
+					Labels:      plLabels(),
+					Annotations: testHookAnnotations(),
+				},
+			},
+		},
+		TestRole: Resource[rbacv1.Role]{
+			ID:       dr.TestRole.ID,
+			HasValue: true,
+			Value: rbacv1.Role{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "Role",
+					APIVersion: "rbac.authorization.k8s.io/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:        fullName + "-test",
+					Labels:      plLabels(),
+					Annotations: testHookAnnotations(),
+				},
+				Rules: []rbacv1.PolicyRule{
+					{
+						APIGroups: []string{"apps"},
+						Resources: []string{"deployments", "replicasets"},
+						Verbs:     []string{"get", "list", "watch"},
+					},
+					{
+						APIGroups: []string{""},
+						Resources: []string{"pods"},
+						Verbs:     []string{"get", "list"},
+					},
+				},
+			},
+		},
+		TestRoleBinding: Resource[rbacv1.RoleBinding]{
+			ID:       dr.TestRoleBinding.ID,
+			HasValue: true,
+			Value: rbacv1.RoleBinding{
+				TypeMeta: v1.TypeMeta{
+					Kind:       "RoleBinding",
+					APIVersion: "rbac.authorization.k8s.io/v1",
+				},
+				ObjectMeta: v1.ObjectMeta{
+					Name:        fullName + "-test",
+					Labels:      plLabels(),
+					Annotations: testHookAnnotations(),
+				},
+				Subjects: []rbacv1.Subject{
+					{
+						Kind:      "ServiceAccount",
+						Name:      fullName + "-test",
+						Namespace: test.Namespace,
+					},
+				},
+				RoleRef: rbacv1.RoleRef{
+					Kind:     "Role",
+					Name:     fullName + "-test",
+					APIGroup: "rbac.authorization.k8s.io",
+				},
+			},
+		},
 		ExtraConfigMap: Resource[corev1.ConfigMap]{
 			ID:       dr.ExtraConfigMap.ID,
 			HasValue: false,
@@ -259,6 +573,13 @@ func DefaultResources(t *testing.T, test *Test) *Resources {
 	}
 }
 
+func networkPolicyPort(protocol corev1.Protocol, port intstr.IntOrString) networkingv1.NetworkPolicyPort {
+	return networkingv1.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &port,
+	}
+}
+
 func TestDefaultValues(t *testing.T) {
 	t.Parallel()
 	test := DefaultTest()
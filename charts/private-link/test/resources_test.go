@@ -4,6 +4,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	corev1 "k8s.io/api/core/v1"
@@ -30,11 +34,18 @@ config:
 	meta := []*v1.ObjectMeta{
 		&expected.Deployment.Value.ObjectMeta,
 		&expected.Deployment.Value.Spec.Template.ObjectMeta,
+		&expected.TokenSecret.Value.ObjectMeta,
+		&expected.TestPod.Value.ObjectMeta,
+		&expected.TestServiceAccount.Value.ObjectMeta,
+		&expected.TestRole.Value.ObjectMeta,
+		&expected.TestRoleBinding.Value.ObjectMeta,
 	}
 	for _, m := range meta {
 		m.Labels["global"] = "global"
 	}
 
+	expected.TestPod.Value.Spec.Containers[0].ImagePullPolicy = corev1.PullAlways
+
 	pts := &expected.Deployment.Value.Spec.Template.Spec
 
 	ctr := &pts.Containers[0]
@@ -122,6 +133,591 @@ config:
 	RenderAndCheck(t, test, expected)
 }
 
+func TestSchedulingOptions(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+global:
+  podTemplate:
+    nodeSelector:
+      kubernetes.io/os: linux
+    tolerations:
+    - key: dedicated
+      operator: Equal
+      value: synadia
+      effect: NoSchedule
+    priorityClassName: global-priority
+podTemplate:
+  affinity:
+    nodeAffinity:
+      requiredDuringSchedulingIgnoredDuringExecution:
+        nodeSelectorTerms:
+        - matchExpressions:
+          - key: kubernetes.io/arch
+            operator: In
+            values:
+            - amd64
+  priorityClassName: high-priority
+  runtimeClassName: gvisor
+
+# These are required options
+config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`
+
+	expected := DefaultResources(t, test)
+
+	pts := &expected.Deployment.Value.Spec.Template.Spec
+	pts.NodeSelector = map[string]string{
+		"kubernetes.io/os": "linux",
+	}
+	pts.Tolerations = []corev1.Toleration{
+		{
+			Key:      "dedicated",
+			Operator: corev1.TolerationOpEqual,
+			Value:    "synadia",
+			Effect:   corev1.TaintEffectNoSchedule,
+		},
+	}
+	pts.Affinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{
+								Key:      "kubernetes.io/arch",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{"amd64"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	pts.PriorityClassName = "high-priority"
+	runtimeClassName := "gvisor"
+	pts.RuntimeClassName = &runtimeClassName
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestImageDigest(t *testing.T) {
+	t.Parallel()
+	digest := "sha256:" + strings.Repeat("0123456789abcdef", 4)
+	values := map[string]struct {
+		values string
+		image  string
+	}{
+		"default registry": {`
+container:
+  image:
+    digest: ` + digest + `
+`, "registry.synadia.io/private-link:1.2.2@" + digest},
+		"global registry without tag": {`
+global:
+  image:
+    registry: docker.io
+container:
+  image:
+    tag: ""
+    digest: ` + digest + `
+`, "docker.io/private-link@" + digest},
+		"image registry": {`
+global:
+  image:
+    registry: docker.io
+container:
+  image:
+    registry: mirror.example.com
+    digest: ` + digest + `
+`, "mirror.example.com/private-link:1.2.2@" + digest},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values + `config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`
+			expected := DefaultResources(t, test)
+			expected.Deployment.Value.Spec.Template.Spec.Containers[0].Image = value.image
+			RenderAndCheck(t, test, expected)
+		})
+	}
+}
+
+func TestImagePullSecrets(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values    string
+		secrets   []string
+		generated bool
+	}{
+		"generated": {`
+imagePullSecret:
+  enabled: true
+`, []string{"private-link-regcred"}, true},
+		"existing names": {`
+global:
+  image:
+    pullSecretNames:
+    - mirror-a
+    - mirror-b
+`, []string{"mirror-a", "mirror-b"}, false},
+		"both": {`
+global:
+  image:
+    pullSecretNames:
+    - mirror-a
+    - private-link-regcred
+imagePullSecret:
+  enabled: true
+`, []string{"private-link-regcred", "mirror-a"}, true},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values + `config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`
+			expected := DefaultResources(t, test)
+
+			var secrets []corev1.LocalObjectReference
+			for _, s := range value.secrets {
+				secrets = append(secrets, corev1.LocalObjectReference{Name: s})
+			}
+			expected.Deployment.Value.Spec.Template.Spec.ImagePullSecrets = secrets
+			expected.TestPod.Value.Spec.ImagePullSecrets = secrets
+			expected.ImagePullSecret.HasValue = value.generated
+
+			RenderAndCheck(t, test, expected)
+		})
+	}
+}
+
+func TestImageDigestInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"short digest": {`container:
+  image:
+    digest: sha256:0123
+`, "private-link image digest sha256:0123 must match sha256:[a-f0-9]{64}"},
+		"test image": {`test:
+  image:
+    digest: sha512:0123
+`, "alpine/k8s image digest sha512:0123 must match sha256:[a-f0-9]{64}"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values + `config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestContainerResources(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+container:
+  resources:
+    requests:
+      cpu: 100m
+      memory: 128Mi
+    limits:
+      memory: 512Mi
+  goMemLimit:
+    enabled: true
+
+# These are required options
+config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`
+	expected := DefaultResources(t, test)
+
+	ctr := &expected.Deployment.Value.Spec.Template.Spec.Containers[0]
+	ctr.Resources = corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("512Mi"),
+		},
+	}
+	ctr.Env = append(ctr.Env, corev1.EnvVar{
+		Name:  "GOMEMLIMIT",
+		Value: "483183820",
+	})
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestContainerResourcesEmpty(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+container:
+  resources: {}
+
+# These are required options
+config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`
+	expected := DefaultResources(t, test)
+	expected.Deployment.Value.Spec.Template.Spec.Containers[0].Resources = corev1.ResourceRequirements{}
+
+	RenderAndCheck(t, test, expected)
+
+	// null uses the defaults
+	test.Values = strings.Replace(test.Values, "resources: {}", "resources: null", 1)
+	RenderAndCheck(t, test, DefaultResources(t, test))
+}
+
+func TestContainerProbes(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+container:
+  probes:
+    startup:
+      enabled: false
+    liveness:
+      periodSeconds: 30
+    readiness:
+      httpGet:
+        path: /healthz
+
+# These are required options
+config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`
+	expected := DefaultResources(t, test)
+
+	ctr := &expected.Deployment.Value.Spec.Template.Spec.Containers[0]
+	ctr.StartupProbe = nil
+	ctr.LivenessProbe.PeriodSeconds = 30
+	ctr.ReadinessProbe.HTTPGet.Path = "/healthz"
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestPodTemplateExtras(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+podTemplate:
+  extraVolumes:
+  - name: kms
+    secret:
+      secretName: kms
+  initContainers:
+  - name: wait-for-postgres
+    image: busybox
+    args:
+    - $tplYaml: >
+        {{ .Release.Name }}-postgres
+  sidecars:
+  - name: ca-bundle
+    image: busybox
+container:
+  extraVolumeMounts:
+  - name: kms
+    mountPath: /etc/kms
+`
+	expected := DefaultResources(t, test)
+
+	pts := &expected.Deployment.Value.Spec.Template.Spec
+	pts.Volumes = []corev1.Volume{{
+		Name: "kms",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: "kms",
+			},
+		},
+	}}
+	pts.InitContainers = []corev1.Container{
+		{
+			Name:  "wait-for-postgres",
+			Image: "busybox",
+			Args:  []string{test.ReleaseName + "-postgres"},
+		},
+	}
+	pts.Containers = append(pts.Containers, corev1.Container{
+		Name:  "ca-bundle",
+		Image: "busybox",
+	})
+
+	ctr := &pts.Containers[0]
+	ctr.VolumeMounts = []corev1.VolumeMount{
+		{
+			Name:      "kms",
+			MountPath: "/etc/kms",
+		},
+	}
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestPodTemplateExtrasInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"volume collides with chart volume": {`config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+  tls:
+    clientCert:
+      enabled: true
+      secretName: my-cert-secret
+podTemplate:
+  extraVolumes:
+  - name: tls-client
+    emptyDir: {}
+`, "podTemplate.extraVolumes name tls-client collides with an existing name"},
+		"duplicate volumes": {`config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+podTemplate:
+  extraVolumes:
+  - name: extra
+    emptyDir: {}
+  - name: extra
+    emptyDir: {}
+`, "podTemplate.extraVolumes name extra collides with an existing name"},
+		"sidecar collides with container": {`config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+podTemplate:
+  sidecars:
+  - name: private-link
+    image: busybox
+`, "podTemplate.sidecars name private-link collides with an existing name"},
+		"init container collides with sidecar": {`config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+podTemplate:
+  sidecars:
+  - name: ca-bundle
+    image: busybox
+  initContainers:
+  - name: ca-bundle
+    image: busybox
+`, "podTemplate.initContainers name ca-bundle collides with an existing name"},
+		"volume without name": {`config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+podTemplate:
+  extraVolumes:
+  - emptyDir: {}
+`, "podTemplate.extraVolumes entries require a name"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestAutoscaling(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values = `
+autoscaling:
+  enabled: true
+  minReplicas: 3
+  maxReplicas: 6
+  targetMemoryUtilizationPercentage: 70
+  metrics:
+  - type: Pods
+    pods:
+      metric:
+        name: nats_requests
+      target:
+        type: AverageValue
+        averageValue: "100"
+
+# These are required options
+config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`
+	expected := DefaultResources(t, test)
+	expected.Deployment.Value.Spec.Replicas = nil
+
+	three := int32(3)
+	memoryUtilization := int32(70)
+	averageValue := resource.MustParse("100")
+	expected.HPA.HasValue = true
+	hpa := &expected.HPA.Value.Spec
+	hpa.MinReplicas = &three
+	hpa.MaxReplicas = 6
+	hpa.Metrics = append(hpa.Metrics,
+		autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: corev1.ResourceMemory,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &memoryUtilization,
+				},
+			},
+		},
+		autoscalingv2.MetricSpec{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{
+				Metric: autoscalingv2.MetricIdentifier{
+					Name: "nats_requests",
+				},
+				Target: autoscalingv2.MetricTarget{
+					Type:         autoscalingv2.AverageValueMetricType,
+					AverageValue: &averageValue,
+				},
+			},
+		},
+	)
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestAutoscalingInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"min greater than max": {`autoscaling:
+  enabled: true
+  minReplicas: 5
+  maxReplicas: 3
+`, "autoscaling.minReplicas must not be greater than autoscaling.maxReplicas"},
+		"no metrics": {`autoscaling:
+  enabled: true
+  targetCPUUtilizationPercentage: null
+`, "autoscaling requires targetCPUUtilizationPercentage, targetMemoryUtilizationPercentage or metrics"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values + `
+config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
+func TestDeploymentRollout(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `
+deployment:
+  strategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxSurge: 25%
+      maxUnavailable: 0
+  minReadySeconds: 5
+  revisionHistoryLimit: 3
+  progressDeadlineSeconds: 120
+`
+	expected := DefaultResources(t, test)
+
+	dep := &expected.Deployment.Value.Spec
+	maxSurge := intstr.FromString("25%")
+	maxUnavailable := intstr.FromInt32(0)
+	dep.Strategy = appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       &maxSurge,
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+	dep.MinReadySeconds = 5
+	revisionHistoryLimit := int32(3)
+	dep.RevisionHistoryLimit = &revisionHistoryLimit
+	progressDeadlineSeconds := int32(120)
+	dep.ProgressDeadlineSeconds = &progressDeadlineSeconds
+
+	RenderAndCheck(t, test, expected)
+}
+
+func TestDeploymentRolloutInvalid(t *testing.T) {
+	t.Parallel()
+	values := map[string]struct {
+		values string
+		err    string
+	}{
+		"unknown strategy": {`deployment:
+  strategy:
+    type: OnDelete
+`, "deployment.strategy.type must be Recreate or RollingUpdate, got OnDelete"},
+		"recreate with rolling update": {`deployment:
+  strategy:
+    type: Recreate
+    rollingUpdate:
+      maxUnavailable: 1
+`, "deployment.strategy.rollingUpdate must not be set when deployment.strategy.type is Recreate"},
+		"zero surge and unavailable": {`deployment:
+  strategy:
+    rollingUpdate:
+      maxSurge: 0%
+      maxUnavailable: 0
+`, "deployment.strategy.rollingUpdate.maxSurge and maxUnavailable must not both be 0"},
+		"negative min ready": {`deployment:
+  minReadySeconds: -5
+`, "deployment.minReadySeconds must not be negative"},
+		"progress deadline before min ready": {`deployment:
+  minReadySeconds: 120
+  progressDeadlineSeconds: 60
+`, "deployment.progressDeadlineSeconds must be greater than deployment.minReadySeconds"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = value.values + `
+config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, value.err)
+		})
+	}
+}
+
 func TestResourcesMergePatch(t *testing.T) {
 	t.Parallel()
 	values := map[string]string{
@@ -0,0 +1,154 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+type Resources struct {
+	Deployment      Resource[appsv1.Deployment]
+	ExternalSecret  Resource[map[string]any]
+	ImagePullSecret Resource[corev1.Secret]
+	NetworkPolicy   Resource[networkingv1.NetworkPolicy]
+	TokenSecret     Resource[corev1.Secret]
+}
+
+func (r *Resources) Iter() []MutableResource {
+	return []MutableResource{
+		r.Deployment.Mutable(),
+		r.ExternalSecret.Mutable(),
+		r.ImagePullSecret.Mutable(),
+		r.NetworkPolicy.Mutable(),
+		r.TokenSecret.Mutable(),
+	}
+}
+
+type Resource[T any] struct {
+	ID       string
+	HasValue bool
+	Value    T
+}
+
+func (r *Resource[T]) Mutable() MutableResource {
+	return MutableResource{
+		ID:        r.ID,
+		HasValueP: &r.HasValue,
+		ValueP:    &r.Value,
+	}
+}
+
+type MutableResource struct {
+	ID        string
+	HasValueP *bool
+	ValueP    any
+}
+
+type K8sResource struct {
+	Kind     string      `yaml:"kind"`
+	Metadata K8sMetadata `yaml:"metadata"`
+}
+
+type K8sMetadata struct {
+	Name string `yaml:"name"`
+}
+
+func GenerateResources(fullName string) *Resources {
+	return &Resources{
+		Deployment: Resource[appsv1.Deployment]{
+			ID: "Deployment/" + fullName,
+		},
+		ExternalSecret: Resource[map[string]any]{
+			ID: "ExternalSecret/" + fullName + "-token",
+		},
+		ImagePullSecret: Resource[corev1.Secret]{
+			ID: "Secret/" + fullName + "-regcred",
+		},
+		NetworkPolicy: Resource[networkingv1.NetworkPolicy]{
+			ID: "NetworkPolicy/" + fullName,
+		},
+		TokenSecret: Resource[corev1.Secret]{
+			ID: "Secret/" + fullName + "-token",
+		},
+	}
+}
+
+type Test struct {
+	ChartName   string
+	ReleaseName string
+	Namespace   string
+	FullName    string
+	Values      string
+}
+
+func DefaultTest() *Test {
+	return &Test{
+		ChartName:   "synadia-deploy",
+		ReleaseName: "synadia-deploy",
+		Namespace:   "synadia-deploy",
+		FullName:    "synadia-deploy",
+		Values: `config:
+  token: agt_my_token
+  natsURL: nats://connect.ngs.global
+`,
+	}
+}
+
+func HelmRenderE(t *testing.T, test *Test) (string, error) {
+	t.Helper()
+
+	helmChartPath, err := filepath.Abs("..")
+	require.NoError(t, err)
+
+	tmpFile, err := os.CreateTemp("", "values.*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write([]byte(test.Values)); err != nil {
+		tmpFile.Close()
+		require.NoError(t, err)
+	}
+	err = tmpFile.Close()
+	require.NoError(t, err)
+
+	options := &helm.Options{
+		ValuesFiles:    []string{tmpFile.Name()},
+		KubectlOptions: k8s.NewKubectlOptions("", "", test.Namespace),
+	}
+	return helm.RenderTemplateE(t, options, helmChartPath, test.ReleaseName, nil)
+}
+
+func HelmRender(t *testing.T, test *Test) *Resources {
+	t.Helper()
+
+	output, err := HelmRenderE(t, test)
+	require.NoError(t, err)
+	outputs := strings.Split(output, "---")
+
+	resources := GenerateResources(test.FullName)
+	for _, o := range outputs {
+		meta := K8sResource{}
+		err := yaml.Unmarshal([]byte(o), &meta)
+		require.NoError(t, err)
+
+		id := meta.Kind + "/" + meta.Metadata.Name
+		for _, r := range resources.Iter() {
+			if id == r.ID {
+				helm.UnmarshalK8SYaml(t, o, r.ValueP)
+				*r.HasValueP = true
+				break
+			}
+		}
+	}
+
+	return resources
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestNetworkPolicy(t *testing.T) {
+	t.Parallel()
+	test := DefaultTest()
+	test.Values += `  platformURL: https://cp.example.com:8443
+  healthPort: 9090
+networkPolicy:
+  enabled: true
+  dns:
+    enabled: false
+`
+	actual := HelmRender(t, test)
+	require.True(t, actual.NetworkPolicy.HasValue)
+	np := actual.NetworkPolicy.Value.Spec
+
+	container := actual.Deployment.Value.Spec.Template.Spec.Containers[0]
+	require.Equal(t, []corev1.ContainerPort{
+		{Name: "health", ContainerPort: 9090, Protocol: corev1.ProtocolTCP},
+	}, container.Ports)
+
+	// the only ingress is the helm test pod, on a port the container listens on
+	require.Len(t, np.Ingress, 1)
+	require.Len(t, np.Ingress[0].From, 1)
+	require.Equal(t, "synadia-deploy-test", np.Ingress[0].From[0].PodSelector.MatchLabels["app.kubernetes.io/component"])
+	require.Equal(t, []networkingv1.NetworkPolicyPort{
+		networkPolicyPort(corev1.ProtocolTCP, intstr.FromString("health")),
+	}, np.Ingress[0].Ports)
+	for _, p := range np.Ingress[0].Ports {
+		require.True(t, slices.ContainsFunc(container.Ports, func(cp corev1.ContainerPort) bool {
+			return cp.Name == p.Port.String() || cp.ContainerPort == p.Port.IntVal
+		}), "ingress port %s is not a container port", p.Port.String())
+	}
+
+	require.Equal(t, []networkingv1.NetworkPolicyEgressRule{
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(4222)),
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(8443)),
+			},
+		},
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(443)),
+				networkPolicyPort(corev1.ProtocolTCP, intstr.FromInt32(6443)),
+			},
+		},
+	}, np.Egress)
+
+	// without the helm test pod nothing is allowed in
+	test.Values += `test:
+  enabled: false
+`
+	actual = HelmRender(t, test)
+	require.Empty(t, actual.NetworkPolicy.Value.Spec.Ingress)
+}
+
+func networkPolicyPort(protocol corev1.Protocol, port intstr.IntOrString) networkingv1.NetworkPolicyPort {
+	return networkingv1.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &port,
+	}
+}
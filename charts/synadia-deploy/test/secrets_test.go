@@ -0,0 +1,120 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTokenSecret(t *testing.T) {
+	test := DefaultTest()
+	resources := HelmRender(t, test)
+
+	require.True(t, resources.TokenSecret.HasValue)
+	require.False(t, resources.ExternalSecret.HasValue)
+	require.Equal(t, "agt_my_token", resources.TokenSecret.Value.StringData["token"])
+}
+
+func TestExternalSecret(t *testing.T) {
+	test := DefaultTest()
+	test.Values = `config:
+  natsURL: nats://connect.ngs.global
+externalSecret:
+  enabled: true
+  secretStoreRef:
+    name: my-store
+    kind: ClusterSecretStore
+  remoteRefs:
+    token:
+      key: synadia-deploy/token
+      property: token
+`
+	output, err := HelmRenderE(t, test)
+	require.NoError(t, err)
+	require.NotContains(t, output, "agt_")
+
+	resources := HelmRender(t, test)
+	require.False(t, resources.TokenSecret.HasValue)
+	require.True(t, resources.ExternalSecret.HasValue)
+
+	spec := resources.ExternalSecret.Value["spec"].(map[string]any)
+	require.Equal(t, "1h", spec["refreshInterval"])
+	require.Equal(t, map[string]any{
+		"name": "my-store",
+		"kind": "ClusterSecretStore",
+	}, spec["secretStoreRef"])
+	require.Equal(t, map[string]any{
+		"name":           "synadia-deploy-token",
+		"creationPolicy": "Owner",
+	}, spec["target"])
+	require.Equal(t, []any{
+		map[string]any{
+			"secretKey": "token",
+			"remoteRef": map[string]any{
+				"key":      "synadia-deploy/token",
+				"property": "token",
+			},
+		},
+	}, spec["data"])
+
+	// the Deployment still reads the token from the Secret created by the ExternalSecret
+	require.Contains(t, resources.Deployment.Value.Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{
+		Name: "SYNADIA_DEPLOY_TOKEN",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "synadia-deploy-token",
+				},
+				Key: "token",
+			},
+		},
+	})
+}
+
+func TestExternalSecretInvalid(t *testing.T) {
+	tests := map[string]struct {
+		values string
+		err    string
+	}{
+		"token and external secret": {
+			values: `config:
+  token: agt_my_token
+externalSecret:
+  enabled: true
+  secretStoreRef:
+    name: my-store
+  remoteRefs:
+    token:
+      key: synadia-deploy/token
+`,
+			err: "config.token must not be set when externalSecret is enabled",
+		},
+		"missing secret store": {
+			values: `externalSecret:
+  enabled: true
+  remoteRefs:
+    token:
+      key: synadia-deploy/token
+`,
+			err: "externalSecret.secretStoreRef.name is required",
+		},
+		"missing remote key": {
+			values: `externalSecret:
+  enabled: true
+  secretStoreRef:
+    name: my-store
+`,
+			err: "externalSecret.remoteRefs.token.key is required",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			test := DefaultTest()
+			test.Values = tc.values
+			_, err := HelmRenderE(t, test)
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}